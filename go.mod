@@ -1,5 +1,8 @@
 module github.com/swinslow/npm-spdx
 
-go 1.12
+go 1.16
 
-require github.com/spdx/tools-golang v0.0.0-20200217195342-b68821f66a8d
+require (
+	github.com/spdx/tools-golang v0.0.0-20200217195342-b68821f66a8d
+	gopkg.in/yaml.v2 v2.4.0
+)
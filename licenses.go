@@ -0,0 +1,56 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright The Linux Foundation and npm-spdx contributors.
+
+package main
+
+import (
+	_ "embed"
+	"log"
+	"path/filepath"
+
+	"github.com/swinslow/npm-spdx/pkg/npm"
+	"github.com/swinslow/npm-spdx/pkg/spdxlicenses"
+)
+
+// the SPDX License List, as compiled into the program
+var (
+	//go:embed data/licenses.json
+	embeddedLicenses []byte
+	//go:embed data/exceptions.json
+	embeddedExceptions []byte
+)
+
+// loadLicenseCatalog returns the SPDX License List compiled into
+// the program or, if licenseList is not empty, the one in the
+// licenses.json file at that path, together with the
+// exceptions.json file in the same directory.
+func loadLicenseCatalog(licenseList string) *spdxlicenses.Catalog {
+	if licenseList == "" {
+		catalog, err := spdxlicenses.ParseJSONLicenseData(embeddedLicenses, embeddedExceptions)
+		if err != nil {
+			log.Fatalf("error loading built-in SPDX license list: %v", err)
+		}
+		return catalog
+	}
+
+	elPath := filepath.Join(filepath.Dir(licenseList), "exceptions.json")
+	catalog, err := spdxlicenses.ParseJSONLicenses(licenseList, elPath)
+	if err != nil {
+		log.Fatalf("error loading SPDX license list from %s, %s: %v", licenseList, elPath, err)
+	}
+	return catalog
+}
+
+// normalizeLicenses converts each result's license to a valid
+// SPDX license expression where possible, keeping the original
+// value in OriginalLicense if it changed.
+func normalizeLicenses(results map[string]*npm.Dependency, catalog *spdxlicenses.Catalog) {
+	n := spdxlicenses.NewNormalizer(catalog)
+	for _, d := range results {
+		lic, ok := n.Normalize(d.License)
+		if ok && lic != d.License {
+			d.OriginalLicense = d.License
+			d.License = lic
+		}
+	}
+}
@@ -4,8 +4,13 @@
 package main
 
 import (
+	"flag"
 	"log"
 	"os"
+	"time"
+
+	"github.com/swinslow/npm-spdx/pkg/npm"
+	"github.com/swinslow/npm-spdx/pkg/spdxpackages"
 )
 
 func main() {
@@ -15,22 +20,94 @@ func main() {
 	switch command {
 
 	case "retrieve":
-		pjsFilename := os.Args[2]
-		pljsFilename := os.Args[3]
-		jsOutput := os.Args[4]
-		retrieve(pjsFilename, pljsFilename, jsOutput)
+		fs, opts := newRetrieveFlagSet("retrieve", printRetrieveUsage)
+		fs.BoolVar(&opts.offline, "offline", false, "")
+		fs.StringVar(&opts.snapshot, "snapshot", "", "")
+		fs.StringVar(&opts.checkpoint, "checkpoint", "", "")
+		fs.BoolVar(&opts.resume, "resume", false, "")
+		fs.BoolVar(&opts.failSoft, "fail-soft", false, "")
+		fs.StringVar(&opts.licenseList, "license-list", "", "")
+		fs.Parse(os.Args[2:])
+		if fs.NArg() != 3 {
+			printRetrieveUsage()
+		}
+
+		pjsFilename := fs.Arg(0)
+		lockFilename := fs.Arg(1)
+		jsOutput := fs.Arg(2)
+		retrieve(pjsFilename, lockFilename, jsOutput, opts)
+
+	case "export-snapshot":
+		fs, opts := newRetrieveFlagSet("export-snapshot", printExportSnapshotUsage)
+		fs.Parse(os.Args[2:])
+		if fs.NArg() != 3 {
+			printExportSnapshotUsage()
+		}
+
+		pjsFilename := fs.Arg(0)
+		lockFilename := fs.Arg(1)
+		snapshotOutput := fs.Arg(2)
+		exportSnapshot(pjsFilename, lockFilename, snapshotOutput, opts)
+
+	case "scan":
+		fs := flag.NewFlagSet("scan", flag.ExitOnError)
+		fs.Usage = printScanUsage
+		licenseList := fs.String("license-list", "", "")
+		fs.Parse(os.Args[2:])
+		if fs.NArg() != 2 {
+			printScanUsage()
+		}
+
+		pjsFilename := fs.Arg(0)
+		jsOutput := fs.Arg(1)
+		scan(pjsFilename, jsOutput, *licenseList)
 
 	case "report":
-		jsResults := os.Args[2]
-		jsReportOutput := os.Args[3]
-		report(jsResults, jsReportOutput)
+		fs := flag.NewFlagSet("report", flag.ExitOnError)
+		fs.Usage = printReportUsage
+		licenseList := fs.String("license-list", "", "")
+		fs.Parse(os.Args[2:])
+		if fs.NArg() != 2 {
+			printReportUsage()
+		}
+
+		jsResults := fs.Arg(0)
+		jsReportOutput := fs.Arg(1)
+		report(jsResults, jsReportOutput, *licenseList)
 
 	case "spdx":
-		jsResults := os.Args[2]
-		spdxOutput := os.Args[3]
-		spdx(jsResults, spdxOutput)
+		fs := flag.NewFlagSet("spdx", flag.ExitOnError)
+		fs.Usage = printSpdxUsage
+		opts := &spdxpackages.BuildOptions{}
+		fs.BoolVar(&opts.UpgradeDeprecated, "upgrade-deprecated", false, "")
+		licenseList := fs.String("license-list", "", "")
+		fs.Parse(os.Args[2:])
+		if fs.NArg() != 2 {
+			printSpdxUsage()
+		}
+
+		jsResults := fs.Arg(0)
+		spdxOutput := fs.Arg(1)
+		spdx(jsResults, spdxOutput, *licenseList, opts)
 
 	default:
 		log.Fatalf("No command specified")
 	}
 }
+
+// newRetrieveFlagSet returns a FlagSet for the options shared by
+// the commands that query the NPM API.
+func newRetrieveFlagSet(name string, usage func()) (*flag.FlagSet, *retrieveOptions) {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Usage = usage
+	opts := &retrieveOptions{}
+	defaults := npm.DefaultRetrieveOptions()
+	fs.StringVar(&opts.registry, "registry", "", "")
+	fs.IntVar(&opts.concurrency, "concurrency", defaults.Concurrency, "")
+	fs.Float64Var(&opts.rate, "rate", defaults.RequestsPerSecond, "")
+	fs.StringVar(&opts.cacheDir, "cache-dir", "", "")
+	fs.BoolVar(&opts.noCache, "no-cache", false, "")
+	fs.DurationVar(&opts.cacheMaxAge, "cache-max-age", 24*time.Hour, "")
+	fs.DurationVar(&opts.timeout, "timeout", time.Minute, "")
+	return fs, opts
+}
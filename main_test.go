@@ -0,0 +1,263 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright The Linux Foundation and npm-spdx contributors.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/swinslow/npm-spdx/pkg/npm"
+	"github.com/swinslow/npm-spdx/pkg/registrytest"
+	"github.com/swinslow/npm-spdx/pkg/spdxpackages"
+)
+
+// fixturesDir contains the registry data for the test project in
+// projectDir, a subset of the examples/ project; see
+// testdata/README.md.
+const (
+	fixturesDir = "testdata/registry"
+	projectDir  = "testdata/project"
+)
+
+var record = flag.Bool("record", false, "record registry fixtures from the live NPM registry")
+
+// newRegistryServer returns a server that replays the registry
+// fixtures, or that records them from the live registry if the
+// -record flag is set.
+func newRegistryServer(t *testing.T) *httptest.Server {
+	if !*record {
+		return registrytest.NewReplayServer(fixturesDir)
+	}
+	srv, err := registrytest.NewRecordingServer(fixturesDir, npm.DefaultRegistryURL)
+	if err != nil {
+		t.Fatalf("error starting recording server: %v", err)
+	}
+	return srv
+}
+
+// loadExampleLicenses returns the license of each package version
+// in examples/results.json that is installed in the test project,
+// keyed by DependencyKey.
+func loadExampleLicenses(t *testing.T, lockDeps map[string]*npm.PackageLockDependency) map[string]string {
+	dr, err := npm.LoadResults("examples/results.json")
+	if err != nil {
+		t.Fatalf("error loading examples/results.json: %v", err)
+	}
+	installed := map[string]bool{}
+	for path, d := range lockDeps {
+		if path != "" {
+			installed[npm.DependencyKey(d.Name, d.Version)] = true
+		}
+	}
+	lics := map[string]string{}
+	for _, d := range dr.Results {
+		if key := npm.DependencyKey(d.Name, d.Version); installed[key] {
+			lics[key] = d.License
+		}
+	}
+	return lics
+}
+
+func TestEndToEndExamples(t *testing.T) {
+	srv := newRegistryServer(t)
+	defer srv.Close()
+
+	// don't pick up the user's own .npmrc settings
+	tmpDir, err := ioutil.TempDir("", "npm-spdx-test-")
+	if err != nil {
+		t.Fatalf("error creating temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	oldHome := os.Getenv("HOME")
+	os.Setenv("HOME", tmpDir)
+	defer os.Setenv("HOME", oldHome)
+
+	resultsPath := filepath.Join(tmpDir, "results.json")
+	summaryPath := filepath.Join(tmpDir, "summary.json")
+	spdxPath := filepath.Join(tmpDir, "sbom.spdx")
+
+	t.Run("retrieve", func(t *testing.T) {
+		opts := &retrieveOptions{
+			registry:    srv.URL,
+			concurrency: 8,
+			noCache:     true,
+			timeout:     time.Minute,
+		}
+		retrieve(filepath.Join(projectDir, "package.json"), filepath.Join(projectDir, "package-lock.json"), resultsPath, opts)
+
+		dr, err := npm.LoadResults(resultsPath)
+		if err != nil {
+			t.Fatalf("error loading results: %v", err)
+		}
+		if dr.Name != "graph-subset" || dr.Version != "0.1.0" {
+			t.Errorf("expected results for graph-subset@0.1.0, got %s", npm.DependencyKey(dr.Name, dr.Version))
+		}
+		if len(dr.Results) != 20 {
+			t.Errorf("expected 20 package versions, got %d", len(dr.Results))
+		}
+		if failed := npm.GetFailedDependencies(dr.Results); len(failed) != 0 {
+			t.Errorf("expected no failures, got %d", len(failed))
+		}
+		if _, err := os.Stat(resultsPath + ".checkpoint"); !os.IsNotExist(err) {
+			t.Errorf("expected checkpoint to be removed, got %v", err)
+		}
+
+		// every package version's license matches the one in
+		// examples/results.json
+		_, _, lockDeps := loadLockDependencies(filepath.Join(projectDir, "package.json"), filepath.Join(projectDir, "package-lock.json"))
+		expected := loadExampleLicenses(t, lockDeps)
+		checked := 0
+		for key, d := range dr.Results {
+			lic, ok := expected[key]
+			if !ok {
+				t.Errorf("expected %s to be in examples/results.json", key)
+				continue
+			}
+			checked++
+			got := d.License
+			if d.OriginalLicense != "" {
+				got = d.OriginalLicense
+			}
+			if got != lic {
+				t.Errorf("expected %s to have license %s, got %s", key, lic, got)
+			}
+		}
+		if checked != len(expected) {
+			t.Errorf("expected %d package versions from examples/results.json, got %d", len(expected), checked)
+		}
+
+		for _, tc := range []struct {
+			key       string
+			direct    bool
+			directDev bool
+		}{
+			{"react@16.7.0", true, false},
+			{"typescript@3.3.3", true, false},
+			{"@types/node@11.9.3", true, false},
+			{"@babel/code-frame@7.0.0", false, true},
+			{"@babel/highlight@7.0.0", false, false},
+		} {
+			d, ok := dr.Results[tc.key]
+			if !ok {
+				t.Errorf("expected %s in results", tc.key)
+				continue
+			}
+			if d.IsDirectDep != tc.direct || d.IsDirectDevDep != tc.directDev {
+				t.Errorf("expected %s to be direct (%v, %v), got (%v, %v)", tc.key, tc.direct, tc.directDev, d.IsDirectDep, d.IsDirectDevDep)
+			}
+		}
+
+		// licenses are normalized, keeping what the package data said
+		if d := dr.Results["optimist@0.6.1"]; d.License != "MIT" || d.OriginalLicense != "MIT/X11" {
+			t.Errorf("expected MIT/X11 to be normalized to MIT, got %q from %q", d.License, d.OriginalLicense)
+		}
+
+		// dependencies resolve to the version installed for that copy
+		if v := dr.Results["@babel/code-frame@7.0.0"].InstalledDependencies["@babel/highlight"]; v != "7.0.0" {
+			t.Errorf("expected @babel/highlight@7.0.0 installed for @babel/code-frame@7.0.0, got %q", v)
+		}
+	})
+
+	t.Run("report", func(t *testing.T) {
+		report(resultsPath, summaryPath, "")
+
+		js, err := ioutil.ReadFile(summaryPath)
+		if err != nil {
+			t.Fatalf("error reading summary: %v", err)
+		}
+		lics := map[string]*licEntry{}
+		err = json.Unmarshal(js, &lics)
+		if err != nil {
+			t.Fatalf("error parsing summary: %v", err)
+		}
+
+		if le := lics["(BSD-3-Clause OR GPL-2.0)"]; le == nil || len(le.Deprecated) != 1 || le.Deprecated[0] != "GPL-2.0" {
+			t.Errorf("expected GPL-2.0 to be flagged as deprecated, got %#v", le)
+		}
+
+		mit, ok := lics["MIT"]
+		if !ok {
+			t.Fatalf("expected MIT in summary")
+		}
+		if !mit.IsSPDX {
+			t.Errorf("expected MIT to be valid")
+		}
+		if len(mit.Licenses) != 1 || mit.Licenses[0].Name != "MIT License" || !mit.Licenses[0].IsOSIApproved {
+			t.Errorf("expected MIT to be described as the OSI-approved MIT License, got %#v", mit.Licenses)
+		}
+		found := false
+		for _, pv := range mit.Deps {
+			if pv.Pkg == "react" && pv.Ver == "16.7.0" && pv.IsDirectDep {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("expected react@16.7.0 as a direct dependency under MIT")
+		}
+
+		total := 0
+		for _, le := range lics {
+			total += len(le.Deps)
+		}
+		if total != 20 {
+			t.Errorf("expected 20 package versions in summary, got %d", total)
+		}
+	})
+
+	t.Run("spdx", func(t *testing.T) {
+		spdx(resultsPath, spdxPath, "data/licenses.json", &spdxpackages.BuildOptions{UpgradeDeprecated: true})
+
+		b, err := ioutil.ReadFile(spdxPath)
+		if err != nil {
+			t.Fatalf("error reading SPDX document: %v", err)
+		}
+		doc := string(b)
+
+		for _, want := range []string{
+			"DocumentName: graph-subset\n",
+			"LicenseListVersion: 3.5\n",
+			"Relationship: SPDXRef-DOCUMENT DESCRIBES SPDXRef-graph-subset-0.1.0\n",
+			"Relationship: SPDXRef-react-16.7.0 PREREQUISITE_FOR SPDXRef-graph-subset-0.1.0\n",
+			"Relationship: SPDXRef-@babel/code-frame-7.0.0 BUILD_TOOL_OF SPDXRef-graph-subset-0.1.0\n",
+			"Relationship: SPDXRef-loose-envify-1.4.0 PREREQUISITE_FOR SPDXRef-react-16.7.0\n",
+			"PackageName: typescript\n",
+			// node-forge@0.7.5 and optimist@0.6.1
+			"PackageLicenseDeclared: BSD-3-Clause OR GPL-2.0-only\n",
+			"PackageLicenseComments: Declared license 'MIT/X11' was normalized to the SPDX license expression 'MIT'\n",
+		} {
+			if !strings.Contains(doc, want) {
+				t.Errorf("expected SPDX document to contain %q", want)
+			}
+		}
+		// the main package plus each package version
+		if n := strings.Count(doc, "PackageName: "); n != 21 {
+			t.Errorf("expected 21 packages, got %d", n)
+		}
+	})
+}
+
+func TestWriteFailureSummary(t *testing.T) {
+	results := map[string]*npm.Dependency{
+		"a@1.0.0": {Name: "a", Version: "1.0.0", License: "MIT"},
+		"c@2.0.0": {Name: "c", Version: "2.0.0", License: "NOASSERTION", Error: "while getting c/2.0.0: timeout"},
+		"b@1.0.0": {Name: "b", Version: "1.0.0", License: "NOASSERTION", Error: "while getting b/1.0.0: not found"},
+	}
+
+	var buf bytes.Buffer
+	writeFailureSummary(&buf, npm.GetFailedDependencies(results))
+	expected := "\n2 package versions could not be retrieved:\n" +
+		"\tb@1.0.0: while getting b/1.0.0: not found\n" +
+		"\tc@2.0.0: while getting c/2.0.0: timeout\n"
+	if buf.String() != expected {
+		t.Errorf("expected %q, got %q", expected, buf.String())
+	}
+}
@@ -4,152 +4,848 @@
 package npm
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"math/rand"
 	"net/http"
 	"net/url"
+	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// GetVersionData queries the NPM API for a specified package
+// and version, and returns a RegistryVersion object with
+// that data. The RegistryConfig determines which registry is
+// queried and with which credentials, and whether responses
+// are cached. It is equivalent to calling GetVersionData on
+// NewClient(cfg), without any way to cancel it.
+func GetVersionData(cfg *RegistryConfig, pkg string, ver string) (*RegistryVersion, error) {
+	return NewClient(cfg).GetVersionData(context.Background(), pkg, ver)
+}
+
+// GetVersionDataForScopedPackage queries the NPM API for a
+// specified _scoped_ package and version, in the same way as
+// GetVersionData.
+func GetVersionDataForScopedPackage(cfg *RegistryConfig, pkg string, ver string) (*RegistryVersion, error) {
+	return NewClient(cfg).getScopedVersionData(context.Background(), pkg, ver)
+}
+
 // GetVersionData queries the NPM API for a specified package
 // and version, and returns a RegistryVersion object with
 // that data.
-func GetVersionData(pkg string, ver string) (*RegistryVersion, error) {
-	// apparently the NPM API doesn't allow retrieving just one version
-	// info for scoped packages. If it's a scoped package, go to a
-	// different function to parse it from the full response with
-	// all versions
+func (c *Client) GetVersionData(ctx context.Context, pkg string, ver string) (*RegistryVersion, error) {
+	// scoped package names need encoding, and not all registries
+	// support retrieving just one version for them, so go to a
+	// different function
 	if strings.HasPrefix(pkg, "@") {
-		return GetVersionDataForScopedPackage(pkg, ver)
+		return c.getScopedVersionData(ctx, pkg, ver)
+	}
+
+	url := c.Config.GetRegistryURL(pkg) + pkg + "/" + ver
+
+	return c.getCachedVersionData(ctx, pkg, ver, url, parseRegistryVersion)
+}
+
+// getScopedVersionData does the work of GetVersionData for a
+// _scoped_ package.
+//
+// It uses the registry's per-version endpoint, with the scoped
+// name encoded as e.g. "@scope%2fname/1.0.0". Some registries
+// don't support that for scoped packages, so if the version isn't
+// found it falls back to the full package document with all
+// versions, which may be several megabytes. (The abbreviated
+// "install" document isn't used, because it omits the license.)
+// Once the full document has had a version that the per-version
+// endpoint didn't, that registry's per-version endpoint isn't
+// tried again; and versions already cached from a full document
+// are revalidated against it directly.
+func (c *Client) getScopedVersionData(ctx context.Context, pkg string, ver string) (*RegistryVersion, error) {
+	reg := c.Config.GetRegistryURL(pkg)
+	if _, ok := c.packumentRegistries.Load(reg); ok || c.isCachedFromPackument(pkg, ver) {
+		return c.getVersionDataFromPackument(ctx, pkg, ver)
+	}
+
+	url := reg + url.PathEscape(pkg) + "/" + ver
+	rver, err := c.getCachedVersionData(ctx, pkg, ver, url, func(b []byte) (*RegistryVersion, error) {
+		c.Config.Stats.addScopedVersion(len(b))
+		return parseRegistryVersion(b)
+	})
+	if err == nil || !errors.Is(err, ErrNotFound) {
+		return rver, err
+	}
+
+	rver, err = c.getVersionDataFromPackument(ctx, pkg, ver)
+	if err == nil {
+		// the version exists, so it's the registry that doesn't
+		// support the per-version endpoint for scoped packages
+		c.packumentRegistries.Store(reg, true)
+	}
+	return rver, err
+}
+
+// getPackumentURL returns the URL of the full document, with all
+// versions, for a package.
+func (c *Client) getPackumentURL(pkg string) string {
+	return c.Config.GetRegistryURL(pkg) + url.PathEscape(pkg)
+}
+
+// isCachedFromPackument returns whether the cached data for a
+// package version, if any, came from the package's full document.
+func (c *Client) isCachedFromPackument(pkg string, ver string) bool {
+	if c.Config.Cache == nil {
+		return false
+	}
+	e, ok := c.Config.Cache.load(pkg, ver)
+	return ok && e.URL == c.getPackumentURL(pkg)
+}
+
+// hasFreshCachedData returns whether GetVersionData would return
+// cached data for a package version without querying the registry.
+func (c *Client) hasFreshCachedData(pkg string, ver string) bool {
+	cache := c.Config.Cache
+	if cache == nil {
+		return false
+	}
+	e, ok := cache.load(pkg, ver)
+	if !ok || !cache.isFresh(e) {
+		return false
+	}
+
+	reg := c.Config.GetRegistryURL(pkg)
+	if !strings.HasPrefix(pkg, "@") {
+		return e.URL == reg+pkg+"/"+ver
+	}
+	if e.URL == c.getPackumentURL(pkg) {
+		return true
+	}
+	_, ok = c.packumentRegistries.Load(reg)
+	return !ok && e.URL == reg+url.PathEscape(pkg)+"/"+ver
+}
+
+// getVersionDataFromPackument gets the data for a specified
+// package version from the package's full document with all
+// versions.
+func (c *Client) getVersionDataFromPackument(ctx context.Context, pkg string, ver string) (*RegistryVersion, error) {
+	url := c.getPackumentURL(pkg)
+
+	return c.getCachedVersionData(ctx, pkg, ver, url, func(b []byte) (*RegistryVersion, error) {
+		c.Config.Stats.addPackument(len(b))
+
+		// parse JSON response
+		rsp := RegistryScopedPackage{}
+		err := json.Unmarshal(b, &rsp)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing NPM registry data: %v", err)
+		}
+
+		rver, ok := rsp.Versions[ver]
+		if !ok {
+			return nil, fmt.Errorf("version %s %w", ver, ErrNotFound)
+		}
+		return rver, nil
+	})
+}
+
+// parseRegistryVersion parses the JSON response for a single
+// package version.
+func parseRegistryVersion(b []byte) (*RegistryVersion, error) {
+	rver := RegistryVersion{}
+	err := json.Unmarshal(b, &rver)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing NPM registry data: %v", err)
+	}
+	return &rver, nil
+}
+
+// getCachedVersionData does the work of GetVersionData, using
+// parse to get the RegistryVersion from the response to url. If
+// the RegistryConfig has a Cache, a fresh cached copy is used
+// without querying the API at all; and a stale one is revalidated
+// with a conditional request.
+func (c *Client) getCachedVersionData(ctx context.Context, pkg string, ver string, url string, parse func([]byte) (*RegistryVersion, error)) (*RegistryVersion, error) {
+	cfg := c.Config
+	var cached *cacheEntry
+	if cfg.Cache != nil {
+		if e, ok := cfg.Cache.load(pkg, ver); ok && e.URL == url {
+			if cfg.Cache.isFresh(e) {
+				fmt.Printf("Using cached data for %s/%s\n", pkg, ver)
+				cfg.Stats.addSaved(e.Size)
+				return e.getRegistryVersion(pkg, ver)
+			}
+			cached = e
+		}
 	}
 
 	fmt.Printf("Getting data for %s/%s\n", pkg, ver)
-	url := "https://registry.npmjs.org/" + pkg + "/" + ver
+	etag := ""
+	if cached != nil {
+		etag = cached.ETag
+	}
 
 	// get data from NPM API
-	res, err := http.Get(url)
+	res, err := c.getRegistryData(ctx, url, etag, nil)
 	if err != nil {
-		return nil, fmt.Errorf("while getting %s/%s: error retrieving NPM registry data: %v", pkg, ver, err)
+		return nil, fmt.Errorf("while getting %s/%s: %w", pkg, ver, err)
 	}
 
-	// read response body
-	b, err := ioutil.ReadAll(res.Body)
-	res.Body.Close()
+	var rver *RegistryVersion
+	size := int64(len(res.body))
+	if res.notModified {
+		size = cached.Size
+		cfg.Stats.addSaved(size)
+		rver, err = cached.getRegistryVersion(pkg, ver)
+	} else {
+		rver, err = parse(res.body)
+		if err != nil {
+			err = fmt.Errorf("while getting %s/%s: %w", pkg, ver, err)
+		}
+	}
 	if err != nil {
-		return nil, fmt.Errorf("while getting %s/%s: error reading NPM registry data: %v", pkg, ver, err)
+		return nil, err
 	}
 
-	// parse JSON response
-	rver := RegistryVersion{}
-	err = json.Unmarshal(b, &rver)
-	if err != nil {
-		return nil, fmt.Errorf("while getting %s/%s: error parsing NPM registry data: %v", pkg, ver, err)
+	// failing to cache the data isn't fatal, it just means we'll
+	// need to get it again next time
+	if cfg.Cache != nil {
+		err = cfg.Cache.store(pkg, ver, url, res.etag, size, rver)
+		if err != nil {
+			fmt.Printf("Warning: couldn't cache data for %s/%s: %v\n", pkg, ver, err)
+		}
 	}
 
-	return &rver, nil
+	return rver, nil
 }
 
-// GetVersionDataForScopedPackage queries the NPM API for a
-// specified _scoped_ package and version, and returns a
-// RegistryVersion object with that data.
-func GetVersionDataForScopedPackage(pkg string, ver string) (*RegistryVersion, error) {
-	fmt.Printf("Getting data for scoped package %s, version %s\n", pkg, ver)
-	url := "https://registry.npmjs.org/" + url.PathEscape(pkg)
+// registryResponse contains the relevant parts of a successful
+// response from the registry.
+type registryResponse struct {
+	body []byte
+	etag string
+	// notModified is true if the request was conditional and the
+	// registry confirmed that the cached copy is still current.
+	notModified bool
+}
 
-	// get data from NPM API
-	res, err := http.Get(url)
+// getRegistryData sends a GET request to the specified registry
+// URL, with any credentials from the RegistryConfig, and returns
+// the response. If etag is not empty, the request is made
+// conditional on it. Network errors, and responses indicating
+// rate limiting or a server error, are retried up to
+// MaxRetries times with jittered exponential backoff (or after
+// the delay requested by the registry, if any). Other
+// unsuccessful responses return a RegistryError immediately.
+//
+// If read is not nil, a successful response's body is passed to
+// read as it is received, rather than being returned; errors from
+// read are not retried.
+func (c *Client) getRegistryData(ctx context.Context, url string, etag string, read func(io.Reader) error) (*registryResponse, error) {
+	cfg := c.Config
+	for attempt := 0; ; attempt++ {
+		res, retryAfter, err := c.tryGetRegistryData(ctx, url, etag, read)
+		if err == nil {
+			return res, nil
+		}
+		if retryAfter < 0 || attempt >= cfg.MaxRetries || ctx.Err() != nil {
+			return nil, err
+		}
+
+		delay := getBackoffDelay(cfg.RetryBaseDelay, attempt)
+		if retryAfter > 0 {
+			delay = retryAfter
+		}
+		fmt.Printf("Retrying %s in %v: %v\n", url, delay.Round(time.Millisecond), err)
+		if err := sleepContext(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// tryGetRegistryData makes a single attempt at getRegistryData.
+// If it fails, it also returns the delay requested by the
+// registry before retrying (zero if none), or -1 if the request
+// should not be retried.
+func (c *Client) tryGetRegistryData(ctx context.Context, url string, etag string, read func(io.Reader) error) (*registryResponse, time.Duration, error) {
+	cfg := c.Config
+	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
-		return nil, fmt.Errorf("while getting %s/%s: error retrieving NPM registry data: %v", pkg, ver, err)
+		return nil, -1, fmt.Errorf("error creating NPM registry request: %v", err)
+	}
+	req = req.WithContext(ctx)
+	if c.UserAgent != "" {
+		req.Header.Set("User-Agent", c.UserAgent)
+	}
+	cfg.authorize(req)
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+
+	res, err := c.httpClient().Do(req)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error retrieving NPM registry data: %w", err)
+	}
+
+	// stream the response body, if requested
+	if read != nil && res.StatusCode >= 200 && res.StatusCode <= 299 {
+		cr := &countingReader{r: res.Body}
+		err = read(cr)
+		res.Body.Close()
+		cfg.Stats.addDownload(int(cr.n))
+		if err != nil {
+			return nil, -1, err
+		}
+		return &registryResponse{etag: res.Header.Get("ETag")}, 0, nil
 	}
 
 	// read response body
 	b, err := ioutil.ReadAll(res.Body)
 	res.Body.Close()
+	cfg.Stats.addDownload(len(b))
 	if err != nil {
-		return nil, fmt.Errorf("while getting %s/%s: error reading NPM registry data: %v", pkg, ver, err)
+		return nil, 0, fmt.Errorf("error reading NPM registry data: %w", err)
 	}
 
-	// parse JSON response
-	rsp := RegistryScopedPackage{}
-	err = json.Unmarshal(b, &rsp)
-	if err != nil {
-		return nil, fmt.Errorf("while getting %s/%s: error parsing NPM registry data: %v", pkg, ver, err)
+	if etag != "" && res.StatusCode == http.StatusNotModified {
+		return &registryResponse{etag: etag, notModified: true}, 0, nil
 	}
 
-	rver, ok := rsp.Versions[ver]
-	if !ok {
-		return nil, fmt.Errorf("while getting %s/%s: version %s not found", pkg, ver, ver)
+	// and make sure it's actually the data we asked for
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		rerr := newRegistryError(url, res)
+		if !rerr.isRetryable() {
+			return nil, -1, rerr
+		}
+		return nil, rerr.RetryAfter, rerr
 	}
 
-	return rver, nil
+	return &registryResponse{body: b, etag: res.Header.Get("ETag")}, 0, nil
+}
+
+// countingReader counts the bytes read from r.
+type countingReader struct {
+	r io.Reader
+	n int64
 }
 
-// GetAllDependencies takes a map of names to PackageLockDependencies
-// and, for each one, retrieves the corresponding RegistryVersion object.
-// It compiles that information into a DependencyResults object, which
-// it then returns.
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += int64(n)
+	return n, err
+}
+
+// maxBackoffDelay is the longest delay between retries, other
+// than one requested by the registry.
+const maxBackoffDelay = 30 * time.Second
+
+// getBackoffDelay returns how long to wait before retrying after
+// the specified (zero-based) attempt: a random duration between
+// half and all of base * 2^attempt, up to maxBackoffDelay.
+func getBackoffDelay(base time.Duration, attempt int) time.Duration {
+	delay := base
+	for i := 0; i < attempt && delay < maxBackoffDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxBackoffDelay {
+		delay = maxBackoffDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// RetrieveOptions configures how GetAllDependencies makes its
+// calls to the NPM API.
+type RetrieveOptions struct {
+	// Concurrency is the maximum number of calls in progress at
+	// once.
+	Concurrency int
+	// RequestsPerSecond is the average rate at which calls may be
+	// started; if it is zero or less, the rate is not limited.
+	RequestsPerSecond float64
+	// Burst is the number of calls that may be started at once
+	// before RequestsPerSecond applies.
+	Burst int
+	// Checkpoint, if not nil, records the data retrieved so far,
+	// and provides any data retrieved by an earlier run that is
+	// being resumed.
+	Checkpoint *Checkpoint
+	// FailSoft, if true, means that a package version that can't
+	// be retrieved doesn't stop the retrieval; instead, its
+	// Dependency is returned with the reason recorded in its Error
+	// field.
+	FailSoft bool
+}
+
+// DefaultRetrieveOptions returns the RetrieveOptions used when
+// none are specified.
+func DefaultRetrieveOptions() *RetrieveOptions {
+	return &RetrieveOptions{
+		Concurrency:       8,
+		RequestsPerSecond: 20,
+		Burst:             8,
+	}
+}
+
+// GetAllDependencies takes a map of PackageLockDependencies, as
+// returned by ParseLockDependencies, and for each one retrieves the
+// corresponding RegistryVersion object. The map is keyed by install
+// path (or by DependencyKey, for lockfiles that don't record install
+// paths), with the root package's entry (if any) under the empty
+// key "". Workspace packages are skipped. The same package version
+// installed at several paths is only retrieved once.
+// It compiles that information into a map of Dependency objects,
+// keyed by DependencyKey, which it then returns.
 // It also takes a PackageManifest (e.g., a parsed package.json file) so
 // that it can note which dependencies are direct or direct dev.
-// The ms parameter configures the sleep time period in milliseconds
-// for a pause between each API call, to avoid overloading the API.
-func GetAllDependencies(deps map[string]*PackageLockDependency, manifest *PackageManifest, ms int) (map[string]*Dependency, error) {
+// The data is retrieved from the Registry, which is usually a
+// Client for an NPM registry; and the RetrieveOptions configure
+// how many requests are made at once and how often, to avoid
+// overloading the API. If opts is nil, DefaultRetrieveOptions is
+// used. If ctx is cancelled, no further requests are made and
+// its error is returned. If the Registry is also a
+// LicenseFileGetter, the text of each license declared as
+// "SEE LICENSE IN <file>" is retrieved from the package tarball.
+func GetAllDependencies(ctx context.Context, reg Registry, deps map[string]*PackageLockDependency, manifest *PackageManifest, opts *RetrieveOptions) (map[string]*Dependency, error) {
+	if opts == nil {
+		opts = DefaultRetrieveOptions()
+	}
+
+	// license files are downloaded under the same limits as the
+	// registry data
+	limiter := newRateLimiter(opts.RequestsPerSecond, opts.Burst)
+	getVersion := newLimitedVersionGetter(ctx, reg, limiter)
+	allDeps, err := collectDependencies(deps, manifest, getVersion, opts.Concurrency, opts.Checkpoint, opts.FailSoft)
+	if err == nil {
+		// in fail-soft mode, cancellation would otherwise just be
+		// recorded as a failure of each remaining package
+		err = ctx.Err()
+	}
+	if err == nil {
+		// and get the text of licenses declared as being in a file
+		if lfg, ok := reg.(LicenseFileGetter); ok {
+			getLicenseFiles(ctx, lfg, allDeps, limiter, opts.Concurrency)
+			err = ctx.Err()
+		}
+	}
+	if err != nil {
+		// keep whatever was retrieved before the failure
+		if cerr := opts.Checkpoint.Save(); cerr != nil {
+			return nil, fmt.Errorf("%w (and %v)", err, cerr)
+		}
+		return nil, err
+	}
+	return allDeps, nil
+}
+
+// versionGetter is a function that returns the RegistryVersion
+// data for the specified package and version, from whichever
+// source is being used. It must be safe to call concurrently.
+type versionGetter func(name string, ver string) (*RegistryVersion, error)
+
+// cachingRegistry is implemented by Registries that keep a local
+// cache of RegistryVersion data.
+type cachingRegistry interface {
+	// hasFreshCachedData returns whether GetVersionData would
+	// return cached data for the specified package and version
+	// without making any request.
+	hasFreshCachedData(pkg string, ver string) bool
+}
+
+// newLimitedVersionGetter returns a versionGetter that gets data
+// from the Registry, limiting how often requests are started with
+// the rateLimiter. Data that a cachingRegistry already has fresh
+// in its cache is returned without waiting, since no request is
+// made for it.
+func newLimitedVersionGetter(ctx context.Context, reg Registry, limiter *rateLimiter) versionGetter {
+	cr, _ := reg.(cachingRegistry)
+	return func(name string, ver string) (*RegistryVersion, error) {
+		if cr == nil || !cr.hasFreshCachedData(name, ver) {
+			err := limiter.wait(ctx)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return reg.GetVersionData(ctx, name, ver)
+	}
+}
+
+// collectDependencies does the work of GetAllDependencies, using
+// getVersion to obtain the RegistryVersion data for each package
+// version, with up to concurrency calls in progress at once. The
+// results do not depend on the order in which those calls finish.
+// Package versions already in the Checkpoint, if any, are not
+// retrieved again, and newly-retrieved ones are added to it. If
+// failSoft is true, package versions that can't be retrieved are
+// recorded as failed rather than stopping the retrieval.
+func collectDependencies(deps map[string]*PackageLockDependency, manifest *PackageManifest, getVersion versionGetter, concurrency int, cp *Checkpoint, failSoft bool) (map[string]*Dependency, error) {
+	root := deps[""]
+	paths := getRetrievedPaths(deps)
+	keys, toGet := getDistinctVersions(deps, paths)
+
 	allDeps := map[string]*Dependency{}
-	for depName, depData := range deps {
-		// check whether we already have a Dependency for this
-		// (which shouldn't happen...)
-		existingDep, ok := allDeps[depName]
-		if ok {
-			return allDeps, fmt.Errorf("while getting %s/%s: already got dependency %s (version %s)", depName, depData.Version, existingDep.Name, existingDep.Version)
+	remaining := []string{}
+	for _, key := range keys {
+		if d, ok := cp.get(key); ok {
+			allDeps[key] = d
+		} else {
+			remaining = append(remaining, key)
 		}
-		d := &Dependency{}
+	}
+	if len(allDeps) > 0 {
+		fmt.Printf("Resuming with %d of %d package versions already retrieved\n", len(allDeps), len(keys))
+	}
 
-		// query the API and get data
-		rver, err := GetVersionData(depName, depData.Version)
-		if err != nil {
-			return nil, err
+	if cp != nil {
+		inner := getVersion
+		getVersion = func(name string, ver string) (*RegistryVersion, error) {
+			rver, err := inner(name, ver)
+			if err != nil {
+				return nil, err
+			}
+			err = cp.add(DependencyKey(name, ver), translateRegistryVersion(rver))
+			if err != nil {
+				return nil, err
+			}
+			return rver, nil
 		}
+	}
 
-		// translate RegistryVersion into a Dependency object
-		d.Name = rver.Name
-		d.Version = rver.Version
-		d.Dependencies = rver.Dependencies
-		d.DevDependencies = rver.DevDependencies
-		// default to NOASSERTION in case we can't fill it in below
-		d.License = "NOASSERTION"
+	rvers, errs := getAllVersions(remaining, toGet, getVersion, concurrency, failSoft)
+	if err := firstError(errs); err != nil && !failSoft {
+		return nil, err
+	}
+	for i, key := range remaining {
+		if errs[i] != nil {
+			allDeps[key] = newFailedDependency(toGet[key], errs[i])
+		} else {
+			allDeps[key] = translateRegistryVersion(rvers[i])
+		}
+	}
+
+	for _, path := range paths {
+		depData := deps[path]
+		d := allDeps[DependencyKey(depData.Name, depData.Version)]
+
+		// record which versions this copy's dependencies resolved
+		// to; copies at different paths may have resolved them
+		// differently
+		for reqName, reqVer := range depData.InstalledDependencies {
+			addInstalledDependency(d, reqName, reqVer)
+		}
+		d.BundledDependencies = mergeNames(d.BundledDependencies, depData.BundledDependencies)
+
+		if root == nil {
+			markDirectDependency(d, manifest, depData.Name)
+		}
+	}
+
+	// also note which are direct dependencies and/or direct dev
+	// deps; only the copies visible from the root package count.
+	// The manifest lists them by the name they are installed under,
+	// which differs from the package's own name for aliases.
+	if root != nil {
+		for instName, v := range root.InstalledDependencies {
+			if d, ok := allDeps[DependencyKey(ParseInstalledVersion(instName, v))]; ok {
+				markDirectDependency(d, manifest, instName)
+			}
+		}
+	}
+
+	return allDeps, nil
+}
+
+// addInstalledDependency records that dependency reqName of
+// package d was resolved to reqVer (a value in the form returned by
+// installedVersion). If another copy of d already resolved it to a
+// different version, reqVer is recorded in OtherInstalledDependencies.
+func addInstalledDependency(d *Dependency, reqName string, reqVer string) {
+	cur, ok := d.InstalledDependencies[reqName]
+	if !ok {
+		d.InstalledDependencies[reqName] = reqVer
+		return
+	}
+	if cur == reqVer {
+		return
+	}
+	if d.OtherInstalledDependencies == nil {
+		d.OtherInstalledDependencies = map[string][]string{}
+	}
+	d.OtherInstalledDependencies[reqName] = mergeNames(d.OtherInstalledDependencies[reqName], []string{reqVer})
+}
+
+// markDirectDependency sets whether d is a direct dependency and/or
+// direct dev dependency of the root package, which installs it as
+// installName.
+func markDirectDependency(d *Dependency, manifest *PackageManifest, installName string) {
+	if _, ok := manifest.Dependencies[installName]; ok {
+		d.IsDirectDep = true
+	}
+	if _, ok := manifest.DevDependencies[installName]; ok {
+		d.IsDirectDevDep = true
+	}
+}
+
+// getRetrievedPaths returns the sorted keys of the entries in deps
+// whose data is retrieved from the registry, so that entries are
+// visited in the same order from one run to the next.
+func getRetrievedPaths(deps map[string]*PackageLockDependency) []string {
+	paths := []string{}
+	for path, depData := range deps {
+		// the root and workspace packages are local, not retrieved
+		if path == "" || depData.IsWorkspace {
+			continue
+		}
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// getDistinctVersions returns the DependencyKey of each distinct
+// package version installed at the specified paths, in order of
+// first appearance, together with a map of those keys to one of
+// the corresponding entries in deps. The same version may be
+// installed at several paths, but only needs to be retrieved once.
+func getDistinctVersions(deps map[string]*PackageLockDependency, paths []string) ([]string, map[string]*PackageLockDependency) {
+	keys := []string{}
+	toGet := map[string]*PackageLockDependency{}
+	for _, path := range paths {
+		depData := deps[path]
+		key := DependencyKey(depData.Name, depData.Version)
+		if _, ok := toGet[key]; !ok {
+			keys = append(keys, key)
+			toGet[key] = depData
+		}
+	}
+	return keys, toGet
+}
+
+// getAllVersions calls getVersion for each of the keys, using a
+// pool of up to concurrency workers, and returns the results and
+// errors in the same order as keys. Unless failSoft is true, once
+// any call fails no further calls are started, so some keys may
+// have neither a result nor an error.
+func getAllVersions(keys []string, toGet map[string]*PackageLockDependency, getVersion versionGetter, concurrency int, failSoft bool) ([]*RegistryVersion, []error) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
 
-		// also translate the license field, which could be a string or
-		// a JSON object (thanks npm)
-		if t, ok := rver.License.(string); ok {
-			// it's just a string, hooray
-			d.License = t
-		} else if t, ok := rver.License.(map[string]interface{}); ok {
-			// it's an object, we can look for an appropriate field
-			if val, ok := t["type"]; ok {
-				// let's also make sure val is a string...
-				if s, ok := val.(string); ok {
-					d.License = s
+	rvers := make([]*RegistryVersion, len(keys))
+	errs := make([]error, len(keys))
+
+	jobs := make(chan int)
+	var failed int32
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				depData := toGet[keys[i]]
+				rvers[i], errs[i] = getVersion(depData.Name, depData.Version)
+				if errs[i] != nil && !failSoft {
+					atomic.StoreInt32(&failed, 1)
 				}
 			}
+		}()
+	}
+
+	for i := range keys {
+		if atomic.LoadInt32(&failed) != 0 {
+			break
 		}
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	return rvers, errs
+}
 
-		// also note whether it's a direct dependency and/or direct dev dep
-		if _, ok := manifest.Dependencies[depName]; ok {
-			d.IsDirectDep = true
+// firstError returns the first non-nil error in errs, if any.
+func firstError(errs []error) error {
+	for _, err := range errs {
+		if err != nil {
+			return err
 		}
-		if _, ok := manifest.DevDependencies[depName]; ok {
-			d.IsDirectDevDep = true
+	}
+	return nil
+}
+
+// newFailedDependency returns the Dependency for a package version
+// whose RegistryVersion couldn't be retrieved, recording why. Its
+// dependencies are taken from the lockfile instead.
+func newFailedDependency(depData *PackageLockDependency, err error) *Dependency {
+	d := &Dependency{
+		Name:                  depData.Name,
+		Version:               depData.Version,
+		License:               "NOASSERTION",
+		InstalledDependencies: map[string]string{},
+		Error:                 err.Error(),
+	}
+	if len(depData.Requires) > 0 {
+		d.Dependencies = map[string]string{}
+		for name, ver := range depData.Requires {
+			d.Dependencies[name] = ver
 		}
+	}
+	return d
+}
 
-		// and finally, add it to the local results
-		allDeps[depName] = d
+// GetFailedDependencies returns the Dependencies in results that
+// couldn't be retrieved, sorted by DependencyKey.
+func GetFailedDependencies(results map[string]*Dependency) []*Dependency {
+	keys := []string{}
+	for key, d := range results {
+		if d.Error != "" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
 
-		// and sleep for a bit
-		time.Sleep(time.Duration(ms) * time.Millisecond)
+	failed := []*Dependency{}
+	for _, key := range keys {
+		failed = append(failed, results[key])
 	}
+	return failed
+}
 
-	return allDeps, nil
+// translateRegistryVersion translates a RegistryVersion into a
+// Dependency object.
+func translateRegistryVersion(rver *RegistryVersion) *Dependency {
+	d := &Dependency{
+		Name:                  rver.Name,
+		Version:               rver.Version,
+		Dependencies:          rver.Dependencies,
+		DevDependencies:       rver.DevDependencies,
+		InstalledDependencies: map[string]string{},
+		BundledDependencies: mergeNames(
+			parseBundledDependencies(rver.BundleDependencies, rver.Dependencies),
+			parseBundledDependencies(rver.BundledDependencies, rver.Dependencies),
+		),
+	}
+	d.License, d.RawLicense = parseLicense(rver.License, rver.Licenses)
+	if d.License == "" {
+		d.License = "NOASSERTION"
+	}
+	if file, ok := GetSeeLicenseFile(d.License); ok {
+		d.LicenseFile = file
+	}
+	if rver.Dist != nil {
+		d.Tarball = rver.Dist.Tarball
+	}
+
+	return d
+}
+
+// parseLicense returns the license expression described by a
+// package's "license" field, or if that doesn't describe one, by
+// its legacy "licenses" field; together with the original value of
+// that field if it wasn't just a string. The license could be a
+// string, an object with a "type" field, or an array of either
+// (thanks npm). Multiple licenses are combined with OR, since npm
+// treats them as alternatives.
+func parseLicense(license interface{}, licenses interface{}) (string, interface{}) {
+	for _, v := range []interface{}{license, licenses} {
+		lic := parseLicenseValue(v)
+		if lic == "" {
+			continue
+		}
+		if _, ok := v.(string); ok {
+			return lic, nil
+		}
+		return lic, v
+	}
+	return "", nil
+}
+
+// parseLicenseValue returns the license expression for one value
+// of a "license" or "licenses" field, or "" if there is none.
+func parseLicenseValue(v interface{}) string {
+	switch t := v.(type) {
+	case string:
+		// it's just a string, hooray
+		return strings.TrimSpace(t)
+	case map[string]interface{}:
+		// it's an object, look for an appropriate field
+		if s, ok := t["type"].(string); ok {
+			return strings.TrimSpace(s)
+		}
+	case []interface{}:
+		// it's a list of alternatives, so combine them, avoiding
+		// duplicates
+		lics := []string{}
+		seen := map[string]bool{}
+		for _, item := range t {
+			lic := parseLicenseValue(item)
+			if lic == "" || seen[lic] {
+				continue
+			}
+			seen[lic] = true
+			lics = append(lics, lic)
+		}
+		if len(lics) == 1 {
+			return lics[0]
+		}
+		for i, lic := range lics {
+			if strings.Contains(lic, " ") && !strings.HasPrefix(lic, "(") {
+				lics[i] = "(" + lic + ")"
+			}
+		}
+		return strings.Join(lics, " OR ")
+	}
+	return ""
+}
+
+// GetRootBundledDependencies returns the sorted names of the
+// dependencies bundled by the root package, as declared in its
+// PackageManifest or recorded in its lockfile.
+func GetRootBundledDependencies(deps map[string]*PackageLockDependency, manifest *PackageManifest) []string {
+	var lockBundled []string
+	if root, ok := deps[""]; ok {
+		lockBundled = root.BundledDependencies
+	}
+	return mergeNames(manifest.GetBundledDependencies(), lockBundled)
+}
+
+// DependencyKey returns the key used for a particular version of
+// a package in DependencyResults, e.g. "debug@4.1.1".
+func DependencyKey(name string, ver string) string {
+	return name + "@" + ver
+}
+
+// installedVersion returns the value recorded in an
+// InstalledDependencies map for version ver of package name, when
+// it is installed under installName. Aliased packages are recorded
+// in the same form that npm uses for them, e.g. "npm:bar@1.0.0".
+func installedVersion(installName string, name string, ver string) string {
+	if installName == name {
+		return ver
+	}
+	return "npm:" + name + "@" + ver
+}
+
+// ParseInstalledVersion takes the name of a dependency and its
+// value in an InstalledDependencies map, and returns the name and
+// version of the package that was actually installed for it. These
+// differ from the dependency's name for aliases, which are recorded
+// as e.g. "npm:bar@1.0.0".
+func ParseInstalledVersion(installName string, v string) (string, string) {
+	if strings.HasPrefix(v, "npm:") {
+		if name, ver := splitYarnSpecifier(strings.TrimPrefix(v, "npm:")); name != "" && ver != "" {
+			return name, ver
+		}
+	}
+	return installName, v
 }
 
 // SaveResults saves the retrieved version data to disk as a
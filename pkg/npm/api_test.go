@@ -0,0 +1,454 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright The Linux Foundation and npm-spdx contributors.
+
+package npm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTranslateRegistryVersionLicense(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		js      string
+		license string
+		raw     interface{}
+	}{
+		{"string", `{"license": "MIT"}`, "MIT", nil},
+		{"object", `{"license": {"type": "ISC", "url": "https://example.com"}}`, "ISC",
+			map[string]interface{}{"type": "ISC", "url": "https://example.com"}},
+		{"legacy array", `{"licenses": [{"type": "MIT"}, {"type": "Apache-2.0"}]}`, "MIT OR Apache-2.0",
+			[]interface{}{map[string]interface{}{"type": "MIT"}, map[string]interface{}{"type": "Apache-2.0"}}},
+		{"legacy array of one", `{"licenses": [{"type": "BSD-3-Clause"}]}`, "BSD-3-Clause",
+			[]interface{}{map[string]interface{}{"type": "BSD-3-Clause"}}},
+		{"legacy array with duplicates and expressions", `{"licenses": ["MIT", {"type": "MIT"}, "GPL-2.0 WITH Classpath-exception-2.0"]}`,
+			"MIT OR (GPL-2.0 WITH Classpath-exception-2.0)",
+			[]interface{}{"MIT", map[string]interface{}{"type": "MIT"}, "GPL-2.0 WITH Classpath-exception-2.0"}},
+		{"license preferred over licenses", `{"license": "MIT", "licenses": [{"type": "ISC"}]}`, "MIT", nil},
+		{"empty license falls back to licenses", `{"license": "", "licenses": [{"type": "ISC"}]}`, "ISC",
+			[]interface{}{map[string]interface{}{"type": "ISC"}}},
+		{"missing", `{}`, "NOASSERTION", nil},
+		{"object without type", `{"license": {"url": "https://example.com"}}`, "NOASSERTION", nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			rver := &RegistryVersion{}
+			err := json.Unmarshal([]byte(tc.js), rver)
+			if err != nil {
+				t.Fatalf("error parsing %s: %v", tc.js, err)
+			}
+
+			d := translateRegistryVersion(rver)
+			if d.License != tc.license {
+				t.Errorf("expected license %q, got %q", tc.license, d.License)
+			}
+			if !reflect.DeepEqual(d.RawLicense, tc.raw) {
+				t.Errorf("expected raw license %#v, got %#v", tc.raw, d.RawLicense)
+			}
+		})
+	}
+}
+
+func TestCollectDependenciesAliasesAndEdges(t *testing.T) {
+	lm, err := ParseLockManifest([]byte(`{
+		"name": "app", "version": "1.0.0", "lockfileVersion": 3,
+		"packages": {
+			"": {"name": "app", "version": "1.0.0"},
+			"node_modules/foo": {"name": "bar", "version": "1.0.0", "dependencies": {"ms": "^2.0.0"}},
+			"node_modules/ms": {"version": "2.1.2"},
+			"node_modules/baz": {"version": "1.0.0", "dependencies": {"foo": "npm:bar@^1.0.0"}},
+			"node_modules/qux": {"version": "1.0.0", "dependencies": {"foo": "npm:bar@^1.0.0"}},
+			"node_modules/qux/node_modules/foo": {"name": "bar", "version": "1.0.0", "dependencies": {"ms": "^2.0.0"}},
+			"node_modules/qux/node_modules/ms": {"version": "2.0.0"}
+		}
+	}`))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	manifest := &PackageManifest{
+		Name:            "app",
+		Version:         "1.0.0",
+		Dependencies:    map[string]string{"foo": "npm:bar@^1.0.0", "baz": "^1.0.0"},
+		DevDependencies: map[string]string{"qux": "^1.0.0"},
+	}
+	getVersion := func(name string, ver string) (*RegistryVersion, error) {
+		return &RegistryVersion{Name: name, Version: ver}, nil
+	}
+
+	allDeps, err := collectDependencies(lm.GetLockDependencies(nil), manifest, getVersion, 1, nil, false)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	for _, tc := range []struct {
+		key       string
+		direct    bool
+		directDev bool
+		installed map[string]string
+		other     map[string][]string
+	}{
+		{"bar@1.0.0", true, false, map[string]string{"ms": "2.1.2"}, map[string][]string{"ms": {"2.0.0"}}},
+		{"baz@1.0.0", true, false, map[string]string{"foo": "npm:bar@1.0.0"}, nil},
+		{"qux@1.0.0", false, true, map[string]string{"foo": "npm:bar@1.0.0"}, nil},
+		{"ms@2.1.2", false, false, map[string]string{}, nil},
+		{"ms@2.0.0", false, false, map[string]string{}, nil},
+	} {
+		d, ok := allDeps[tc.key]
+		if !ok {
+			t.Errorf("%s: expected to be found", tc.key)
+			continue
+		}
+		if d.IsDirectDep != tc.direct || d.IsDirectDevDep != tc.directDev {
+			t.Errorf("%s: expected direct (%v, %v), got (%v, %v)", tc.key, tc.direct, tc.directDev, d.IsDirectDep, d.IsDirectDevDep)
+		}
+		if !reflect.DeepEqual(d.InstalledDependencies, tc.installed) {
+			t.Errorf("%s: expected installed %v, got %v", tc.key, tc.installed, d.InstalledDependencies)
+		}
+		if !reflect.DeepEqual(d.OtherInstalledDependencies, tc.other) {
+			t.Errorf("%s: expected other installed %v, got %v", tc.key, tc.other, d.OtherInstalledDependencies)
+		}
+	}
+}
+
+func TestCollectDependenciesBundled(t *testing.T) {
+	lm, err := ParseLockManifest([]byte(`{
+		"name": "app", "version": "1.0.0", "lockfileVersion": 3,
+		"packages": {
+			"": {"name": "app", "version": "1.0.0"},
+			"node_modules/a": {"version": "1.0.0", "inBundle": true, "dependencies": {"b": "^1.0.0"}},
+			"node_modules/b": {"version": "1.0.0", "inBundle": true},
+			"node_modules/c": {"version": "1.0.0", "dependencies": {"d": "^1.0.0", "e": "^1.0.0"}},
+			"node_modules/c/node_modules/d": {"version": "1.0.0", "inBundle": true},
+			"node_modules/e": {"version": "1.0.0"}
+		}
+	}`))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	manifest := &PackageManifest{
+		Name:               "app",
+		Version:            "1.0.0",
+		Dependencies:       map[string]string{"a": "^1.0.0", "c": "^1.0.0"},
+		BundleDependencies: []interface{}{"a"},
+	}
+	registryDeps := map[string]map[string]string{
+		"a": {"b": "^1.0.0"},
+		"c": {"d": "^1.0.0", "e": "^1.0.0"},
+	}
+	getVersion := func(name string, ver string) (*RegistryVersion, error) {
+		rver := &RegistryVersion{Name: name, Version: ver, Dependencies: registryDeps[name]}
+		// e is also declared as bundled in its own package.json,
+		// though it has no dependencies to bundle
+		if name == "e" {
+			rver.BundleDependencies = true
+		}
+		return rver, nil
+	}
+
+	deps := lm.GetLockDependencies(nil)
+	if got := GetRootBundledDependencies(deps, manifest); !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Errorf("expected root to bundle [a b], got %v", got)
+	}
+
+	allDeps, err := collectDependencies(deps, manifest, getVersion, 1, nil, false)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	for _, tc := range []struct {
+		key     string
+		bundled []string
+	}{
+		{"a@1.0.0", nil},
+		{"b@1.0.0", nil},
+		{"c@1.0.0", []string{"d"}},
+		{"d@1.0.0", nil},
+		{"e@1.0.0", nil},
+	} {
+		d, ok := allDeps[tc.key]
+		if !ok {
+			t.Errorf("%s: expected to be found", tc.key)
+			continue
+		}
+		if len(d.BundledDependencies) != len(tc.bundled) || (len(tc.bundled) > 0 && !reflect.DeepEqual(d.BundledDependencies, tc.bundled)) {
+			t.Errorf("%s: expected bundled %v, got %v", tc.key, tc.bundled, d.BundledDependencies)
+		}
+	}
+}
+
+func TestGetBundledDependencies(t *testing.T) {
+	deps := map[string]string{"a": "^1.0.0", "b": "^1.0.0"}
+	for _, tc := range []struct {
+		name     string
+		manifest *PackageManifest
+		expected []string
+	}{
+		{"none", &PackageManifest{Dependencies: deps}, nil},
+		{"array", &PackageManifest{Dependencies: deps, BundleDependencies: []interface{}{"b"}}, []string{"b"}},
+		{"other spelling", &PackageManifest{Dependencies: deps, BundledDependencies: []interface{}{"a"}}, []string{"a"}},
+		{"true", &PackageManifest{Dependencies: deps, BundleDependencies: true}, []string{"a", "b"}},
+		{"false", &PackageManifest{Dependencies: deps, BundleDependencies: false}, nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := tc.manifest.GetBundledDependencies()
+			if len(got) != len(tc.expected) || (len(got) > 0 && !reflect.DeepEqual(got, tc.expected)) {
+				t.Errorf("expected %v, got %v", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestGetAllDependenciesFailSoft(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/a/1.0.0":
+			w.Write([]byte(`{"name":"a","version":"1.0.0","license":"MIT","dependencies":{"b":"^1.0.0"}}`))
+		case "/c/1.0.0":
+			w.Write([]byte(`{"name":"c","version":"1.0.0","license":"ISC"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	cfg := NewRegistryConfig()
+	cfg.SetRegistry(srv.URL)
+	deps := map[string]*PackageLockDependency{
+		"node_modules/a": {Name: "a", Version: "1.0.0", Requires: map[string]string{"b": "^1.0.0"}},
+		"node_modules/b": {Name: "b", Version: "1.0.0", Requires: map[string]string{"c": "^1.0.0"}},
+		"node_modules/c": {Name: "c", Version: "1.0.0"},
+	}
+	manifest := &PackageManifest{Name: "app", Version: "1.0.0", Dependencies: map[string]string{"a": "^1.0.0"}}
+
+	_, err := GetAllDependencies(context.Background(), NewClient(cfg), deps, manifest, nil)
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected not found error without fail-soft, got %v", err)
+	}
+
+	opts := DefaultRetrieveOptions()
+	opts.FailSoft = true
+	allDeps, err := GetAllDependencies(context.Background(), NewClient(cfg), deps, manifest, opts)
+	if err != nil {
+		t.Fatalf("expected no error with fail-soft, got %v", err)
+	}
+	if len(allDeps) != 3 {
+		t.Errorf("expected 3 results, got %d", len(allDeps))
+	}
+	b := allDeps["b@1.0.0"]
+	if b == nil || b.License != "NOASSERTION" || b.Error == "" {
+		t.Fatalf("expected b to be recorded as failed, got %+v", b)
+	}
+	if !reflect.DeepEqual(b.Dependencies, map[string]string{"c": "^1.0.0"}) {
+		t.Errorf("expected b's dependencies from the lockfile, got %v", b.Dependencies)
+	}
+	if a := allDeps["a@1.0.0"]; a.License != "MIT" || a.Error != "" {
+		t.Errorf("expected a to be retrieved, got %+v", a)
+	}
+
+	failed := GetFailedDependencies(allDeps)
+	if len(failed) != 1 || failed[0] != b {
+		t.Errorf("expected only b to be listed as failed, got %v", failed)
+	}
+}
+
+func TestParseInstalledVersion(t *testing.T) {
+	for _, tc := range []struct {
+		instName string
+		v        string
+		name     string
+		ver      string
+	}{
+		{"ms", "2.1.2", "ms", "2.1.2"},
+		{"foo", "npm:bar@1.0.0", "bar", "1.0.0"},
+		{"foo", "npm:@scope/bar@1.0.0", "@scope/bar", "1.0.0"},
+		{"foo", "npm:", "foo", "npm:"},
+	} {
+		name, ver := ParseInstalledVersion(tc.instName, tc.v)
+		if name != tc.name || ver != tc.ver {
+			t.Errorf("(%q, %q): expected (%q, %q), got (%q, %q)", tc.instName, tc.v, tc.name, tc.ver, name, ver)
+		}
+	}
+}
+
+// getVersionKeys returns n keys, and the corresponding entries to
+// get, for packages named "p0", "p1" and so on.
+func getVersionKeys(n int) ([]string, map[string]*PackageLockDependency) {
+	keys := []string{}
+	toGet := map[string]*PackageLockDependency{}
+	for i := 0; i < n; i++ {
+		name := fmt.Sprintf("p%d", i)
+		key := DependencyKey(name, "1.0.0")
+		keys = append(keys, key)
+		toGet[key] = &PackageLockDependency{Name: name, Version: "1.0.0"}
+	}
+	return keys, toGet
+}
+
+func TestGetAllVersionsOrder(t *testing.T) {
+	keys, toGet := getVersionKeys(20)
+	var inProgress, maxInProgress int32
+	getVersion := func(name string, ver string) (*RegistryVersion, error) {
+		n := atomic.AddInt32(&inProgress, 1)
+		defer atomic.AddInt32(&inProgress, -1)
+		for {
+			max := atomic.LoadInt32(&maxInProgress)
+			if n <= max || atomic.CompareAndSwapInt32(&maxInProgress, max, n) {
+				break
+			}
+		}
+		// earlier keys take longer, so they finish out of order
+		var i int
+		fmt.Sscanf(name, "p%d", &i)
+		time.Sleep(time.Duration(20-i) * time.Millisecond)
+		if i == 5 {
+			return nil, errors.New("failed")
+		}
+		return &RegistryVersion{Name: name, Version: ver}, nil
+	}
+
+	rvers, errs := getAllVersions(keys, toGet, getVersion, 4, true)
+	for i, key := range keys {
+		if i == 5 {
+			if errs[i] == nil || rvers[i] != nil {
+				t.Errorf("%s: expected only an error, got (%v, %v)", key, rvers[i], errs[i])
+			}
+			continue
+		}
+		if errs[i] != nil || rvers[i] == nil || DependencyKey(rvers[i].Name, rvers[i].Version) != key {
+			t.Errorf("%s: expected result in order, got (%v, %v)", key, rvers[i], errs[i])
+		}
+	}
+	if max := atomic.LoadInt32(&maxInProgress); max < 2 || max > 4 {
+		t.Errorf("expected between 2 and 4 calls at once, got %d", max)
+	}
+}
+
+func TestGetAllVersionsStopsOnError(t *testing.T) {
+	keys, toGet := getVersionKeys(100)
+	var calls int32
+	getVersion := func(name string, ver string) (*RegistryVersion, error) {
+		atomic.AddInt32(&calls, 1)
+		if name == "p0" {
+			return nil, errors.New("failed")
+		}
+		time.Sleep(10 * time.Millisecond)
+		return &RegistryVersion{Name: name, Version: ver}, nil
+	}
+
+	_, errs := getAllVersions(keys, toGet, getVersion, 2, false)
+	if errs[0] == nil {
+		t.Errorf("expected error for first key")
+	}
+	if err := firstError(errs); err != errs[0] {
+		t.Errorf("expected first error to be the first key's, got %v", err)
+	}
+	// the workers may each start one more call before the failure
+	// is noticed, but no more
+	if n := atomic.LoadInt32(&calls); n > 4 {
+		t.Errorf("expected retrieval to stop after the error, got %d calls", n)
+	}
+
+	atomic.StoreInt32(&calls, 0)
+	_, errs = getAllVersions(keys, toGet, getVersion, 2, true)
+	if n := atomic.LoadInt32(&calls); n != 100 {
+		t.Errorf("expected all 100 calls when failing soft, got %d", n)
+	}
+	if errs[0] == nil || firstError(errs[1:]) != nil {
+		t.Errorf("expected only the first key to fail, got %v", firstError(errs))
+	}
+}
+
+func TestGetBackoffDelay(t *testing.T) {
+	for _, tc := range []struct {
+		base    time.Duration
+		attempt int
+		min     time.Duration
+		max     time.Duration
+	}{
+		{time.Second, 0, 500 * time.Millisecond, time.Second},
+		{time.Second, 1, time.Second, 2 * time.Second},
+		{time.Second, 3, 4 * time.Second, 8 * time.Second},
+		{time.Second, 10, maxBackoffDelay / 2, maxBackoffDelay},
+		{time.Second, 100, maxBackoffDelay / 2, maxBackoffDelay},
+		{0, 3, 0, 0},
+	} {
+		for i := 0; i < 20; i++ {
+			d := getBackoffDelay(tc.base, tc.attempt)
+			if d < tc.min || d > tc.max {
+				t.Errorf("(%v, %d): expected delay between %v and %v, got %v", tc.base, tc.attempt, tc.min, tc.max, d)
+				break
+			}
+		}
+	}
+}
+
+func TestGetRegistryDataRetries(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		statuses []int
+		header   string
+		requests int32
+		err      error
+	}{
+		{"success", []int{200}, "", 1, nil},
+		{"retried after server errors", []int{500, 503, 200}, "", 3, nil},
+		{"retried after rate limiting", []int{429, 200}, "", 2, nil},
+		{"retried after Retry-After", []int{429, 200}, "1", 2, nil},
+		{"not found is not retried", []int{404, 200}, "", 1, ErrNotFound},
+		{"gives up after MaxRetries", []int{500, 500, 500, 500}, "", 3, ErrServer},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var requests int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := atomic.AddInt32(&requests, 1)
+				status := tc.statuses[n-1]
+				if status == http.StatusTooManyRequests && tc.header != "" {
+					w.Header().Set("Retry-After", tc.header)
+				}
+				w.WriteHeader(status)
+				w.Write([]byte(`{}`))
+			}))
+			defer srv.Close()
+
+			cfg := NewRegistryConfig()
+			cfg.MaxRetries = 2
+			cfg.RetryBaseDelay = time.Millisecond
+			start := time.Now()
+			_, err := NewClient(cfg).getRegistryData(context.Background(), srv.URL+"/a/1.0.0", "", nil)
+			if tc.err == nil && err != nil {
+				t.Errorf("expected no error, got %v", err)
+			}
+			if tc.err != nil && !errors.Is(err, tc.err) {
+				t.Errorf("expected %v, got %v", tc.err, err)
+			}
+			if requests != tc.requests {
+				t.Errorf("expected %d requests, got %d", tc.requests, requests)
+			}
+			if tc.header != "" && time.Since(start) < time.Second {
+				t.Errorf("expected to wait for Retry-After, took %v", time.Since(start))
+			}
+		})
+	}
+}
+
+func TestGetRegistryDataCancelledDuringBackoff(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := NewClient(NewRegistryConfig()).getRegistryData(ctx, srv.URL+"/a/1.0.0", "", nil)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context.DeadlineExceeded, got %v", err)
+	}
+}
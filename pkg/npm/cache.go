@@ -0,0 +1,138 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright The Linux Foundation and npm-spdx contributors.
+
+package npm
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Cache stores the registry data for each package version on
+// disk, so that repeated runs don't need to download it again.
+// Entries younger than MaxAge are used without querying the
+// registry; older ones are revalidated using their ETag.
+type Cache struct {
+	Dir    string
+	MaxAge time.Duration
+}
+
+// cacheFormat identifies the version of the RegistryVersion data
+// stored in cache entries. It is increased when RegistryVersion
+// gains fields, so that entries saved without them are retrieved
+// again rather than used.
+const cacheFormat = 3
+
+// cacheEntry is the on-disk representation of one package
+// version's registry data. Data contains just the
+// RegistryVersion, even for scoped packages whose URL returns
+// data for all versions. Entries exported in a Snapshot have no
+// URL or ETag.
+type cacheEntry struct {
+	Format  int       `json:"format,omitempty"`
+	URL     string    `json:"url,omitempty"`
+	ETag    string    `json:"etag,omitempty"`
+	Fetched time.Time `json:"fetched"`
+	// Size is the size of the response the entry came from.
+	Size int64           `json:"size,omitempty"`
+	Data json.RawMessage `json:"data"`
+}
+
+// DefaultCacheDir returns the directory used for the Cache when
+// none is specified: "npm-spdx" within the user's cache
+// directory.
+func DefaultCacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("error finding user cache directory: %v", err)
+	}
+	return filepath.Join(dir, "npm-spdx"), nil
+}
+
+// NewCache returns a Cache stored in dir, creating it if
+// needed.
+func NewCache(dir string, maxAge time.Duration) (*Cache, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, fmt.Errorf("error creating cache directory %s: %v", dir, err)
+	}
+	return &Cache{Dir: dir, MaxAge: maxAge}, nil
+}
+
+// getPath returns the path of the file for a package version.
+// Scoped package names are escaped so they don't create
+// subdirectories.
+func (c *Cache) getPath(pkg string, ver string) string {
+	return filepath.Join(c.Dir, url.PathEscape(DependencyKey(pkg, ver))+".json")
+}
+
+// load returns the cache entry for a package version, if any.
+// Unreadable entries, and those in an older format, are treated
+// as missing.
+func (c *Cache) load(pkg string, ver string) (*cacheEntry, bool) {
+	js, err := ioutil.ReadFile(c.getPath(pkg, ver))
+	if err != nil {
+		return nil, false
+	}
+
+	e := &cacheEntry{}
+	err = json.Unmarshal(js, e)
+	if err != nil || e.Format != cacheFormat {
+		return nil, false
+	}
+	return e, true
+}
+
+// isFresh returns whether a cache entry can be used without
+// revalidating it.
+func (c *Cache) isFresh(e *cacheEntry) bool {
+	return time.Since(e.Fetched) < c.MaxAge
+}
+
+// store saves the cache entry for a package version, replacing
+// the file atomically so that readers never see a partial entry.
+func (c *Cache) store(pkg string, ver string, url string, etag string, size int64, rver *RegistryVersion) error {
+	js, err := marshalCacheEntry(url, etag, time.Now().UTC(), size, rver)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(c.getPath(pkg, ver), js)
+}
+
+// marshalCacheEntry returns the JSON representation of the cache
+// entry for the RegistryVersion.
+func marshalCacheEntry(url string, etag string, fetched time.Time, size int64, rver *RegistryVersion) ([]byte, error) {
+	data, err := json.Marshal(rver)
+	if err != nil {
+		return nil, fmt.Errorf("error marshalling cache entry to JSON: %v", err)
+	}
+	js, err := json.Marshal(&cacheEntry{
+		Format:  cacheFormat,
+		URL:     url,
+		ETag:    etag,
+		Fetched: fetched,
+		Size:    size,
+		Data:    data,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error marshalling cache entry to JSON: %v", err)
+	}
+	return js, nil
+}
+
+// getRegistryVersion parses the RegistryVersion stored in the
+// cache entry.
+func (e *cacheEntry) getRegistryVersion(pkg string, ver string) (*RegistryVersion, error) {
+	rver := &RegistryVersion{}
+	err := json.Unmarshal(e.Data, rver)
+	if err != nil {
+		return nil, fmt.Errorf("while getting %s/%s: error parsing cached registry data: %v", pkg, ver, err)
+	}
+	return rver, nil
+}
@@ -0,0 +1,305 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright The Linux Foundation and npm-spdx contributors.
+
+package npm
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// etagServer is a stand-in registry serving one package version,
+// whose ETag and license can be changed between requests.
+type etagServer struct {
+	sync.Mutex
+	etag        string
+	license     string
+	requests    int
+	conditional int
+}
+
+func (s *etagServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.Lock()
+	defer s.Unlock()
+	s.requests++
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		s.conditional++
+		if inm == s.etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+	w.Header().Set("ETag", s.etag)
+	w.Write([]byte(`{"name":"a","version":"1.0.0","license":"` + s.license + `"}`))
+}
+
+func TestCacheETagRevalidation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "npm-spdx-test-")
+	if err != nil {
+		t.Fatalf("error creating temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	es := &etagServer{etag: `"v1"`, license: "MIT"}
+	srv := httptest.NewServer(es)
+	defer srv.Close()
+
+	cache, err := NewCache(dir, time.Hour)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	for _, tc := range []struct {
+		name        string
+		maxAge      time.Duration
+		etag        string
+		license     string
+		expLicense  string
+		requests    int
+		conditional int
+		saved       bool
+	}{
+		{"first request is downloaded", time.Hour, `"v1"`, "MIT", "MIT", 1, 0, false},
+		{"fresh entry is used without a request", time.Hour, `"v1"`, "MIT", "MIT", 0, 0, true},
+		{"stale entry is revalidated", 0, `"v1"`, "MIT", "MIT", 1, 1, true},
+		{"changed data is downloaded again", 0, `"v2"`, "ISC", "ISC", 1, 1, false},
+		{"and replaces the cached copy", time.Hour, `"v2"`, "ISC", "ISC", 0, 0, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			es.Lock()
+			es.etag, es.license = tc.etag, tc.license
+			es.requests, es.conditional = 0, 0
+			es.Unlock()
+
+			cache.MaxAge = tc.maxAge
+			cfg := NewRegistryConfig()
+			cfg.Registry = srv.URL + "/"
+			cfg.Cache = cache
+			rver, err := NewClient(cfg).GetVersionData(context.Background(), "a", "1.0.0")
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if rver.License != tc.expLicense {
+				t.Errorf("expected license %s, got %v", tc.expLicense, rver.License)
+			}
+			if es.requests != tc.requests || es.conditional != tc.conditional {
+				t.Errorf("expected %d requests (%d conditional), got %d (%d)", tc.requests, tc.conditional, es.requests, es.conditional)
+			}
+			if saved := cfg.Stats.BytesSaved() > 0; saved != tc.saved {
+				t.Errorf("expected bytes saved %v, got %d", tc.saved, cfg.Stats.BytesSaved())
+			}
+
+			e, ok := cache.load("a", "1.0.0")
+			if !ok {
+				t.Fatalf("expected cache entry")
+			}
+			if e.ETag != tc.etag || e.URL != srv.URL+"/a/1.0.0" {
+				t.Errorf("expected entry for %s with ETag %s, got %s with %s", srv.URL+"/a/1.0.0", tc.etag, e.URL, e.ETag)
+			}
+		})
+	}
+}
+
+func TestCacheLoadIgnoresOtherFormats(t *testing.T) {
+	dir, err := ioutil.TempDir("", "npm-spdx-test-")
+	if err != nil {
+		t.Fatalf("error creating temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	cache, err := NewCache(dir, time.Hour)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	for _, tc := range []struct {
+		name string
+		js   string
+		ok   bool
+	}{
+		{"current format", fmt.Sprintf(`{"format": %d, "fetched": "2019-01-01T00:00:00Z", "data": {}}`, cacheFormat), true},
+		{"older format", fmt.Sprintf(`{"format": %d, "fetched": "2019-01-01T00:00:00Z", "data": {}}`, cacheFormat-1), false},
+		{"no format", `{"fetched": "2019-01-01T00:00:00Z", "data": {}}`, false},
+		{"invalid JSON", `{`, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ioutil.WriteFile(cache.getPath("a", "1.0.0"), []byte(tc.js), 0644)
+			if err != nil {
+				t.Fatalf("error writing cache entry: %v", err)
+			}
+			if _, ok := cache.load("a", "1.0.0"); ok != tc.ok {
+				t.Errorf("expected %v, got %v", tc.ok, ok)
+			}
+		})
+	}
+}
+
+func TestScopedPackumentFallback(t *testing.T) {
+	dir, err := ioutil.TempDir("", "npm-spdx-test-")
+	if err != nil {
+		t.Fatalf("error creating temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	var mu sync.Mutex
+	requests := []string{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests = append(requests, r.URL.EscapedPath())
+		mu.Unlock()
+		switch r.URL.EscapedPath() {
+		case "/@s%2Fa":
+			w.Header().Set("ETag", `"a"`)
+			if r.Header.Get("If-None-Match") == `"a"` {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Write([]byte(`{"versions":{"1.0.0":{"name":"@s/a","version":"1.0.0","license":"MIT"}}}`))
+		case "/@s%2Fb":
+			w.Write([]byte(`{"versions":{"1.0.0":{"name":"@s/b","version":"1.0.0","license":"ISC"}}}`))
+		default:
+			// no per-version endpoint for scoped packages
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	cache, err := NewCache(dir, 0)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	var c *Client
+	for _, tc := range []struct {
+		name       string
+		newClient  bool
+		pkg        string
+		requests   []string
+		packuments int64
+	}{
+		{"falls back to the full document", true, "@s/a", []string{"/@s%2Fa/1.0.0", "/@s%2Fa"}, 1},
+		{"remembers the fallback for the registry", false, "@s/b", []string{"/@s%2Fb"}, 1},
+		{"revalidates cached full documents directly", true, "@s/a", []string{"/@s%2Fa"}, 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			mu.Lock()
+			requests = []string{}
+			mu.Unlock()
+
+			if tc.newClient {
+				cfg := NewRegistryConfig()
+				cfg.Registry = srv.URL + "/"
+				cfg.Cache = cache
+				c = NewClient(cfg)
+			}
+			c.Config.Stats = &TransferStats{}
+			if _, err := c.GetVersionData(context.Background(), tc.pkg, "1.0.0"); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if !reflect.DeepEqual(requests, tc.requests) {
+				t.Errorf("expected requests %v, got %v", tc.requests, requests)
+			}
+			if n, _ := c.Config.Stats.Packuments(); n != tc.packuments {
+				t.Errorf("expected %d full documents, got %d", tc.packuments, n)
+			}
+		})
+	}
+}
+
+func TestScopedVersionStats(t *testing.T) {
+	body := `{"name":"@s/a","version":"1.0.0","license":"MIT"}`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	}))
+	defer srv.Close()
+
+	cfg := NewRegistryConfig()
+	cfg.Registry = srv.URL + "/"
+	if _, err := NewClient(cfg).GetVersionData(context.Background(), "@s/a", "1.0.0"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if n, size := cfg.Stats.ScopedVersions(); n != 1 || size != int64(len(body)) {
+		t.Errorf("expected 1 scoped version of %d bytes, got %d of %d", len(body), n, size)
+	}
+	if n, _ := cfg.Stats.Packuments(); n != 0 {
+		t.Errorf("expected no full documents, got %d", n)
+	}
+}
+
+func TestCachedLookupsNotRateLimited(t *testing.T) {
+	dir, err := ioutil.TempDir("", "npm-spdx-test-")
+	if err != nil {
+		t.Fatalf("error creating temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	var mu sync.Mutex
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests++
+		mu.Unlock()
+		w.Write([]byte(`{"name":"a","version":"1.0.0","license":"MIT"}`))
+	}))
+	defer srv.Close()
+
+	cfg := NewRegistryConfig()
+	cfg.SetRegistry(srv.URL)
+	cfg.Cache, err = NewCache(dir, time.Hour)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	c := NewClient(cfg)
+
+	names := []string{"@s/a"}
+	for i := 0; i < 9; i++ {
+		names = append(names, fmt.Sprintf("p%d", i))
+	}
+	for _, name := range names {
+		if c.hasFreshCachedData(name, "1.0.0") {
+			t.Errorf("%s: expected no cached data yet", name)
+		}
+		if _, err := c.GetVersionData(context.Background(), name, "1.0.0"); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if !c.hasFreshCachedData(name, "1.0.0") {
+			t.Errorf("%s: expected fresh cached data", name)
+		}
+	}
+
+	// 2 per second, so uncached lookups after the first wait 500ms
+	getVersion := newLimitedVersionGetter(context.Background(), c, newRateLimiter(2, 1))
+	mu.Lock()
+	requests = 0
+	mu.Unlock()
+	start := time.Now()
+	for _, name := range names {
+		if _, err := getVersion(name, "1.0.0"); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > 250*time.Millisecond {
+		t.Errorf("expected cached lookups not to be rate limited, took %v", elapsed)
+	}
+	mu.Lock()
+	if requests != 0 {
+		t.Errorf("expected no requests for cached lookups, got %d", requests)
+	}
+	mu.Unlock()
+
+	start = time.Now()
+	for _, name := range []string{"q0", "q1"} {
+		if _, err := getVersion(name, "1.0.0"); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Errorf("expected uncached lookups to be rate limited, took %v", elapsed)
+	}
+}
@@ -0,0 +1,204 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright The Linux Foundation and npm-spdx contributors.
+
+package npm
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// DefaultCheckpointInterval is the number of newly-retrieved
+// package versions after which a Checkpoint is saved, if no
+// other interval is set.
+const DefaultCheckpointInterval = 50
+
+// Checkpoint records the Dependency data retrieved so far by
+// GetAllDependencies, saving it to disk periodically as a partial
+// DependencyResults file, so that an interrupted or failed
+// retrieval can be resumed without retrieving the same data again.
+// A nil Checkpoint records nothing.
+type Checkpoint struct {
+	// Path is the file the Checkpoint is saved to.
+	Path string
+	// Interval is the number of newly-retrieved package versions
+	// after which the Checkpoint is saved.
+	Interval int
+
+	mu      sync.Mutex
+	dr      *DependencyResults
+	unsaved int
+}
+
+// NewCheckpoint returns an empty Checkpoint for the specified
+// root package, which will be saved to path.
+func NewCheckpoint(path string, manifest *PackageManifest) *Checkpoint {
+	return &Checkpoint{
+		Path:     path,
+		Interval: DefaultCheckpointInterval,
+		dr: &DependencyResults{
+			Name:    manifest.Name,
+			Version: manifest.Version,
+			License: manifest.License,
+			Results: map[string]*Dependency{},
+		},
+	}
+}
+
+// LoadCheckpoint reads a previously-saved Checkpoint from path,
+// so that its entries are not retrieved again. It returns an
+// empty Checkpoint if the file doesn't exist, and an error if it
+// was saved for a different root package.
+func LoadCheckpoint(path string, manifest *PackageManifest) (*Checkpoint, error) {
+	cp := NewCheckpoint(path, manifest)
+
+	js, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return cp, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading checkpoint %s: %v", path, err)
+	}
+
+	dr := &DependencyResults{}
+	err = json.Unmarshal(js, dr)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing checkpoint %s: %v", path, err)
+	}
+	if dr.Name != manifest.Name || dr.Version != manifest.Version {
+		return nil, fmt.Errorf("checkpoint %s is for %s, not %s", path, DependencyKey(dr.Name, dr.Version), DependencyKey(manifest.Name, manifest.Version))
+	}
+	if dr.Results != nil {
+		cp.dr.Results = dr.Results
+	}
+
+	return cp, nil
+}
+
+// get returns a copy of the Dependency recorded for key, if any.
+func (cp *Checkpoint) get(key string) (*Dependency, bool) {
+	if cp == nil {
+		return nil, false
+	}
+
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	d, ok := cp.dr.Results[key]
+	if !ok {
+		return nil, false
+	}
+	return copyDependency(d), true
+}
+
+// add records the Dependency for key, saving the Checkpoint if
+// Interval package versions have been added since it was last
+// saved.
+func (cp *Checkpoint) add(key string, d *Dependency) error {
+	if cp == nil {
+		return nil
+	}
+
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	cp.dr.Results[key] = copyDependency(d)
+	cp.unsaved++
+	if cp.unsaved < cp.Interval {
+		return nil
+	}
+	return cp.save()
+}
+
+// Save writes the Checkpoint to disk.
+func (cp *Checkpoint) Save() error {
+	if cp == nil {
+		return nil
+	}
+
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	return cp.save()
+}
+
+// save does the work of Save; cp.mu must be held.
+func (cp *Checkpoint) save() error {
+	js, err := json.Marshal(cp.dr)
+	if err != nil {
+		return fmt.Errorf("error marshalling checkpoint to JSON: %v", err)
+	}
+	err = writeFileAtomic(cp.Path, js)
+	if err != nil {
+		return fmt.Errorf("error saving checkpoint: %v", err)
+	}
+	cp.unsaved = 0
+	return nil
+}
+
+// Remove deletes the Checkpoint's file, e.g. once the complete
+// results have been saved.
+func (cp *Checkpoint) Remove() error {
+	if cp == nil {
+		return nil
+	}
+
+	err := os.Remove(cp.Path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error removing checkpoint: %v", err)
+	}
+	return nil
+}
+
+// copyDependency returns a copy of d with its own
+// InstalledDependencies and OtherInstalledDependencies maps, which
+// collectDependencies fills in separately for each run.
+func copyDependency(d *Dependency) *Dependency {
+	c := *d
+	c.InstalledDependencies = map[string]string{}
+	for name, ver := range d.InstalledDependencies {
+		c.InstalledDependencies[name] = ver
+	}
+	c.OtherInstalledDependencies = nil
+	for name, vers := range d.OtherInstalledDependencies {
+		if c.OtherInstalledDependencies == nil {
+			c.OtherInstalledDependencies = map[string][]string{}
+		}
+		c.OtherInstalledDependencies[name] = append([]string{}, vers...)
+	}
+	return &c
+}
+
+// writeFileAtomic writes data to filename by way of a temporary
+// file in the same directory, so that readers never see a partial
+// file.
+func writeFileAtomic(filename string, data []byte) error {
+	return writeFileAtomicFunc(filename, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+}
+
+// writeFileAtomicFunc does the same as writeFileAtomic, with the
+// data written by write instead. If write fails, filename is left
+// unchanged.
+func writeFileAtomicFunc(filename string, write func(io.Writer) error) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(filename), ".tmp-")
+	if err != nil {
+		return fmt.Errorf("error creating temporary file: %v", err)
+	}
+	err = write(tmp)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), filename)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("error writing %s: %v", filename, err)
+	}
+	return nil
+}
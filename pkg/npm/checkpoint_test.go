@@ -0,0 +1,140 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright The Linux Foundation and npm-spdx contributors.
+
+package npm
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+)
+
+// recordingGetter returns a versionGetter that records the keys it
+// is called for, and fails for those in fail.
+func recordingGetter(mu *sync.Mutex, called *[]string, fail map[string]bool) versionGetter {
+	return func(name string, ver string) (*RegistryVersion, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		key := DependencyKey(name, ver)
+		*called = append(*called, key)
+		if fail[key] {
+			return nil, fmt.Errorf("%s %w", key, ErrNotFound)
+		}
+		return &RegistryVersion{Name: name, Version: ver, License: "MIT"}, nil
+	}
+}
+
+func TestCheckpointResume(t *testing.T) {
+	dir, err := ioutil.TempDir("", "npm-spdx-test-")
+	if err != nil {
+		t.Fatalf("error creating temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "results.json.checkpoint")
+
+	manifest := &PackageManifest{Name: "app", Version: "1.0.0", Dependencies: map[string]string{"a": "^1.0.0", "b": "^1.0.0"}}
+	deps := map[string]*PackageLockDependency{
+		"":               {Name: "app", Version: "1.0.0", InstalledDependencies: map[string]string{"a": "1.0.0", "b": "1.0.0", "c": "1.0.0"}},
+		"node_modules/a": {Name: "a", Version: "1.0.0", InstalledDependencies: map[string]string{"c": "1.0.0"}},
+		"node_modules/b": {Name: "b", Version: "1.0.0"},
+		"node_modules/c": {Name: "c", Version: "1.0.0"},
+	}
+
+	for _, tc := range []struct {
+		name     string
+		fail     map[string]bool
+		failSoft bool
+		called   []string
+		err      bool
+		saved    []string
+	}{
+		{"fails part way", map[string]bool{"c@1.0.0": true}, false, []string{"a@1.0.0", "b@1.0.0", "c@1.0.0"}, true, []string{"a@1.0.0", "b@1.0.0"}},
+		{"fails soft", map[string]bool{"c@1.0.0": true}, true, []string{"c@1.0.0"}, false, []string{"a@1.0.0", "b@1.0.0"}},
+		{"retries just the failure", nil, false, []string{"c@1.0.0"}, false, []string{"a@1.0.0", "b@1.0.0", "c@1.0.0"}},
+		{"retrieves nothing more", nil, false, []string{}, false, []string{"a@1.0.0", "b@1.0.0", "c@1.0.0"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cp, err := LoadCheckpoint(path, manifest)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			cp.Interval = 1
+
+			var mu sync.Mutex
+			called := []string{}
+			allDeps, err := collectDependencies(deps, manifest, recordingGetter(&mu, &called, tc.fail), 1, cp, tc.failSoft)
+			if (err != nil) != tc.err {
+				t.Fatalf("expected error %v, got %v", tc.err, err)
+			}
+			if !reflect.DeepEqual(called, tc.called) {
+				t.Errorf("expected calls for %v, got %v", tc.called, called)
+			}
+			if err := cp.Save(); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+
+			saved, err := LoadResults(path)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			keys := []string{}
+			for key := range saved.Results {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			if !reflect.DeepEqual(keys, tc.saved) {
+				t.Errorf("expected checkpoint to contain %v, got %v", tc.saved, keys)
+			}
+
+			if !tc.err {
+				// resumed results are the same as if retrieved at once
+				a := allDeps["a@1.0.0"]
+				if !a.IsDirectDep || !reflect.DeepEqual(a.InstalledDependencies, map[string]string{"c": "1.0.0"}) {
+					t.Errorf("expected a@1.0.0 to be a direct dependency installing c@1.0.0, got %v, %v", a.IsDirectDep, a.InstalledDependencies)
+				}
+				if allDeps["c@1.0.0"].IsDirectDep {
+					t.Errorf("expected c@1.0.0 not to be a direct dependency")
+				}
+			}
+		})
+	}
+}
+
+func TestLoadCheckpoint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "npm-spdx-test-")
+	if err != nil {
+		t.Fatalf("error creating temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "checkpoint")
+
+	manifest := &PackageManifest{Name: "app", Version: "1.0.0"}
+	cp, err := LoadCheckpoint(path, manifest)
+	if err != nil {
+		t.Fatalf("expected no error for missing checkpoint, got %v", err)
+	}
+	if _, ok := cp.get("a@1.0.0"); ok {
+		t.Errorf("expected empty checkpoint")
+	}
+
+	cp.add("a@1.0.0", &Dependency{Name: "a", Version: "1.0.0", InstalledDependencies: map[string]string{}})
+	if err := cp.Save(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	_, err = LoadCheckpoint(path, &PackageManifest{Name: "app", Version: "2.0.0"})
+	if err == nil {
+		t.Errorf("expected error for checkpoint of a different package")
+	}
+
+	if err := cp.Remove(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expected checkpoint to be removed")
+	}
+}
@@ -0,0 +1,76 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright The Linux Foundation and npm-spdx contributors.
+
+package npm
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DefaultUserAgent is the User-Agent header sent to the registry
+// by a Client, unless it sets a different one.
+const DefaultUserAgent = "npm-spdx (+https://github.com/swinslow/npm-spdx)"
+
+// Registry is a source of RegistryVersion data for package
+// versions, such as an NPM registry. Implementations must be safe
+// for concurrent use.
+type Registry interface {
+	// GetVersionData returns the RegistryVersion data for the
+	// specified package and version. It should stop and return
+	// an error if ctx is cancelled.
+	GetVersionData(ctx context.Context, pkg string, ver string) (*RegistryVersion, error)
+}
+
+// Client is a Registry that queries an NPM registry over HTTP.
+type Client struct {
+	// Config determines which registry is queried for each
+	// package and with which credentials, how failed requests are
+	// retried, and whether responses are cached.
+	Config *RegistryConfig
+	// HTTPClient is used to send requests, and can be set to
+	// configure timeouts, proxies, TLS and so on. If it is nil,
+	// http.DefaultClient is used.
+	HTTPClient *http.Client
+	// UserAgent is sent as the User-Agent header of each request.
+	UserAgent string
+
+	// packumentRegistries records the URLs of registries that
+	// don't support the per-version endpoint for scoped packages.
+	packumentRegistries sync.Map
+}
+
+// NewClient returns a Client for the RegistryConfig, using
+// http.DefaultClient and DefaultUserAgent.
+func NewClient(cfg *RegistryConfig) *Client {
+	return &Client{
+		Config:    cfg,
+		UserAgent: DefaultUserAgent,
+	}
+}
+
+// httpClient returns the *http.Client to use for requests.
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+// sleepContext waits for the specified duration, or until ctx is
+// cancelled, in which case it returns ctx's error.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,86 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright The Linux Foundation and npm-spdx contributors.
+
+package npm
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Errors matched (using errors.Is) by a RegistryError, according
+// to its HTTP status code.
+var (
+	// ErrNotFound indicates that the package or version does not
+	// exist in the registry, or has been unpublished.
+	ErrNotFound = errors.New("not found in registry")
+	// ErrRateLimited indicates that the registry refused the
+	// request because too many requests have been made.
+	ErrRateLimited = errors.New("rate limited by registry")
+	// ErrServer indicates that the registry failed to handle the
+	// request.
+	ErrServer = errors.New("registry server error")
+)
+
+// RegistryError is returned when the NPM registry responds to a
+// request with an unsuccessful HTTP status code.
+type RegistryError struct {
+	URL        string
+	StatusCode int
+	// RetryAfter is the delay requested by the response's
+	// Retry-After header, or zero if it had none.
+	RetryAfter time.Duration
+}
+
+func (e *RegistryError) Error() string {
+	msg := fmt.Sprintf("NPM registry returned HTTP status %d (%s) for %s", e.StatusCode, http.StatusText(e.StatusCode), e.URL)
+	if kind := e.Unwrap(); kind != nil {
+		msg += ": " + kind.Error()
+	}
+	return msg
+}
+
+// Unwrap returns ErrNotFound, ErrRateLimited or ErrServer as
+// appropriate for the status code, or nil for other statuses.
+func (e *RegistryError) Unwrap() error {
+	switch {
+	case e.StatusCode == http.StatusNotFound || e.StatusCode == http.StatusGone:
+		return ErrNotFound
+	case e.StatusCode == http.StatusTooManyRequests:
+		return ErrRateLimited
+	case e.StatusCode >= 500:
+		return ErrServer
+	default:
+		return nil
+	}
+}
+
+// isRetryable returns whether the request might succeed if it
+// is repeated later.
+func (e *RegistryError) isRetryable() bool {
+	return e.StatusCode == http.StatusRequestTimeout ||
+		e.StatusCode == http.StatusTooManyRequests ||
+		e.StatusCode >= 500
+}
+
+// newRegistryError creates a RegistryError for an unsuccessful
+// response, parsing its Retry-After header if present.
+func newRegistryError(url string, res *http.Response) *RegistryError {
+	e := &RegistryError{URL: url, StatusCode: res.StatusCode}
+
+	// Retry-After is either a number of seconds or an HTTP date
+	if ra := res.Header.Get("Retry-After"); ra != "" {
+		if secs, err := strconv.Atoi(ra); err == nil && secs > 0 {
+			e.RetryAfter = time.Duration(secs) * time.Second
+		} else if t, err := http.ParseTime(ra); err == nil {
+			if d := time.Until(t); d > 0 {
+				e.RetryAfter = d
+			}
+		}
+	}
+
+	return e
+}
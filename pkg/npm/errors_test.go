@@ -0,0 +1,66 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright The Linux Foundation and npm-spdx contributors.
+
+package npm
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestNewRegistryErrorRetryAfter(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		retryAfter string
+		min        time.Duration
+		max        time.Duration
+	}{
+		{"none", "", 0, 0},
+		{"seconds", "120", 120 * time.Second, 120 * time.Second},
+		{"zero seconds", "0", 0, 0},
+		{"negative seconds", "-5", 0, 0},
+		{"HTTP date", time.Now().Add(time.Minute).UTC().Format(http.TimeFormat), 58 * time.Second, time.Minute},
+		{"HTTP date in the past", time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat), 0, 0},
+		{"invalid", "soon", 0, 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			res := &http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{}}
+			if tc.retryAfter != "" {
+				res.Header.Set("Retry-After", tc.retryAfter)
+			}
+			e := newRegistryError("https://registry.example.com/a/1.0.0", res)
+			if e.RetryAfter < tc.min || e.RetryAfter > tc.max {
+				t.Errorf("expected RetryAfter between %v and %v, got %v", tc.min, tc.max, e.RetryAfter)
+			}
+		})
+	}
+}
+
+func TestRegistryErrorKinds(t *testing.T) {
+	for _, tc := range []struct {
+		status    int
+		kind      error
+		retryable bool
+	}{
+		{http.StatusNotFound, ErrNotFound, false},
+		{http.StatusGone, ErrNotFound, false},
+		{http.StatusTooManyRequests, ErrRateLimited, true},
+		{http.StatusInternalServerError, ErrServer, true},
+		{http.StatusBadGateway, ErrServer, true},
+		{http.StatusRequestTimeout, nil, true},
+		{http.StatusUnauthorized, nil, false},
+	} {
+		e := &RegistryError{URL: "https://registry.example.com/a/1.0.0", StatusCode: tc.status}
+		if tc.kind != nil && !errors.Is(e, tc.kind) {
+			t.Errorf("%d: expected error to be %v", tc.status, tc.kind)
+		}
+		if e.Unwrap() != tc.kind {
+			t.Errorf("%d: expected Unwrap to return %v, got %v", tc.status, tc.kind, e.Unwrap())
+		}
+		if e.isRetryable() != tc.retryable {
+			t.Errorf("%d: expected isRetryable %v, got %v", tc.status, tc.retryable, e.isRetryable())
+		}
+	}
+}
@@ -0,0 +1,178 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright The Linux Foundation and npm-spdx contributors.
+
+package npm
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// seeLicensePrefix begins npm's license declaration for a package
+// whose license is in a file, e.g. "SEE LICENSE IN LICENSE.txt".
+const seeLicensePrefix = "SEE LICENSE IN "
+
+// maxLicenseFileSize is the most text read from a license file.
+const maxLicenseFileSize = 1 << 20
+
+// GetSeeLicenseFile returns the file named by a license
+// declaration of the form "SEE LICENSE IN <file>", and true; or
+// false if the license isn't declared that way.
+func GetSeeLicenseFile(lic string) (string, bool) {
+	lic = strings.TrimSpace(lic)
+	if len(lic) <= len(seeLicensePrefix) || !strings.EqualFold(lic[:len(seeLicensePrefix)], seeLicensePrefix) {
+		return "", false
+	}
+	return strings.TrimSpace(lic[len(seeLicensePrefix):]), true
+}
+
+// IsUnlicensed returns whether a license declaration is
+// "UNLICENSED", which npm uses to mark a package whose authors
+// don't grant others the right to use it, e.g. because it's
+// proprietary.
+func IsUnlicensed(lic string) bool {
+	return strings.EqualFold(strings.TrimSpace(lic), "UNLICENSED")
+}
+
+// LicenseFileGetter is implemented by Registries that can retrieve
+// files from a package version's published tarball, for license
+// declarations of the form "SEE LICENSE IN <file>".
+type LicenseFileGetter interface {
+	// GetLicenseFile returns the text of the file at filename,
+	// relative to the package's root directory, within the
+	// tarball at tarballURL.
+	GetLicenseFile(ctx context.Context, tarballURL string, filename string) (string, error)
+}
+
+// maxTarballSize is the most data read from a package tarball
+// while looking for a license file.
+const maxTarballSize = 64 << 20
+
+// GetLicenseFile downloads the tarball at tarballURL and returns
+// the text of the file at filename within it. The tarball is read
+// as it is downloaded, and only until the file is found.
+func (c *Client) GetLicenseFile(ctx context.Context, tarballURL string, filename string) (string, error) {
+	var text string
+	_, err := c.getRegistryData(ctx, tarballURL, "", func(r io.Reader) error {
+		var err error
+		text, err = readTarballFile(io.LimitReader(r, maxTarballSize), filename)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	return text, nil
+}
+
+// readTarballFile returns the text of the file at filename within
+// a package tarball read from r. Files in the tarball are relative
+// to a single top-level directory, usually "package".
+func readTarballFile(r io.Reader, filename string) (string, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return "", fmt.Errorf("error reading package tarball: %v", err)
+	}
+	defer gz.Close()
+
+	want := path.Clean(strings.TrimPrefix(filename, "./"))
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("error reading package tarball: %v", err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		i := strings.IndexByte(hdr.Name, '/')
+		if i < 0 || path.Clean(hdr.Name[i+1:]) != want {
+			continue
+		}
+		text, err := ioutil.ReadAll(io.LimitReader(tr, maxLicenseFileSize))
+		if err != nil {
+			return "", fmt.Errorf("error reading %s from package tarball: %v", filename, err)
+		}
+		return string(text), nil
+	}
+
+	return "", fmt.Errorf("%s not found in package tarball", filename)
+}
+
+// getLicenseFiles fills in the LicenseText of each Dependency
+// whose license is declared as "SEE LICENSE IN <file>", by
+// retrieving the file from its tarball. Up to concurrency tarballs
+// are retrieved at once, and the rateLimiter limits how often they
+// are started. Failures aren't fatal, since the declaration itself
+// is still recorded.
+func getLicenseFiles(ctx context.Context, lfg LicenseFileGetter, allDeps map[string]*Dependency, limiter *rateLimiter, concurrency int) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	jobs := make(chan *Dependency)
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for d := range jobs {
+				getLicenseFile(ctx, lfg, d, limiter)
+			}
+		}()
+	}
+
+	for _, key := range getSortedKeys(allDeps) {
+		d := allDeps[key]
+		if d.LicenseFile == "" || d.LicenseText != "" || d.Error != "" {
+			continue
+		}
+		if d.Tarball == "" {
+			fmt.Printf("Warning: couldn't get %s for %s/%s: no tarball URL\n", d.LicenseFile, d.Name, d.Version)
+			continue
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		jobs <- d
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+// getLicenseFile does the work of getLicenseFiles for one
+// Dependency.
+func getLicenseFile(ctx context.Context, lfg LicenseFileGetter, d *Dependency, limiter *rateLimiter) {
+	if err := limiter.wait(ctx); err != nil {
+		return
+	}
+
+	fmt.Printf("Getting %s for %s/%s\n", d.LicenseFile, d.Name, d.Version)
+	text, err := lfg.GetLicenseFile(ctx, d.Tarball, d.LicenseFile)
+	if err != nil {
+		fmt.Printf("Warning: couldn't get %s for %s/%s: %v\n", d.LicenseFile, d.Name, d.Version, err)
+		return
+	}
+	d.LicenseText = text
+}
+
+// getSortedKeys returns the keys of allDeps in sorted order.
+func getSortedKeys(allDeps map[string]*Dependency) []string {
+	keys := []string{}
+	for key := range allDeps {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,131 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright The Linux Foundation and npm-spdx contributors.
+
+package npm
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGetSeeLicenseFile(t *testing.T) {
+	for _, tc := range []struct {
+		lic  string
+		file string
+		ok   bool
+	}{
+		{"SEE LICENSE IN LICENSE.txt", "LICENSE.txt", true},
+		{"see license in ./docs/EULA.md ", "./docs/EULA.md", true},
+		{"SEE LICENSE IN ", "", false},
+		{"MIT", "", false},
+		{"UNLICENSED", "", false},
+	} {
+		file, ok := GetSeeLicenseFile(tc.lic)
+		if file != tc.file || ok != tc.ok {
+			t.Errorf("%q: expected (%q, %v), got (%q, %v)", tc.lic, tc.file, tc.ok, file, ok)
+		}
+	}
+}
+
+func TestIsUnlicensed(t *testing.T) {
+	if !IsUnlicensed("UNLICENSED") || !IsUnlicensed(" unlicensed") {
+		t.Errorf("expected UNLICENSED to be recognized")
+	}
+	if IsUnlicensed("Unlicense") {
+		t.Errorf("expected Unlicense not to be UNLICENSED")
+	}
+}
+
+// buildTarball returns a gzipped tarball containing the files.
+func buildTarball(t *testing.T, files map[string]string) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, text := range files {
+		err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(text)), Typeflag: tar.TypeReg})
+		if err != nil {
+			t.Fatalf("error writing tarball: %v", err)
+		}
+		tw.Write([]byte(text))
+	}
+	tw.Close()
+	gz.Close()
+	return buf.Bytes()
+}
+
+func TestGetAllDependenciesGetsLicenseFiles(t *testing.T) {
+	tarball := buildTarball(t, map[string]string{
+		"package/package.json": "{}",
+		"package/LICENSE.txt":  "Proprietary license text",
+	})
+
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/a/1.0.0":
+			w.Write([]byte(`{"name":"a","version":"1.0.0","license":"SEE LICENSE IN ./LICENSE.txt","dist":{"tarball":"` + srv.URL + `/a/-/a-1.0.0.tgz"}}`))
+		case "/b/1.0.0":
+			w.Write([]byte(`{"name":"b","version":"1.0.0","license":"SEE LICENSE IN MISSING","dist":{"tarball":"` + srv.URL + `/a/-/a-1.0.0.tgz"}}`))
+		case "/a/-/a-1.0.0.tgz":
+			w.Write(tarball)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	cfg := NewRegistryConfig()
+	cfg.SetRegistry(srv.URL)
+	deps := map[string]*PackageLockDependency{
+		"node_modules/a": {Name: "a", Version: "1.0.0"},
+		"node_modules/b": {Name: "b", Version: "1.0.0"},
+	}
+	allDeps, err := GetAllDependencies(context.Background(), NewClient(cfg), deps, &PackageManifest{}, nil)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	a := allDeps["a@1.0.0"]
+	if a.LicenseFile != "./LICENSE.txt" || a.LicenseText != "Proprietary license text" {
+		t.Errorf("expected license file text for a, got %q: %q", a.LicenseFile, a.LicenseText)
+	}
+	b := allDeps["b@1.0.0"]
+	if b.LicenseFile != "MISSING" || b.LicenseText != "" || !strings.HasPrefix(b.License, "SEE LICENSE IN") {
+		t.Errorf("expected no license file text for b, got %q: %q", b.LicenseFile, b.LicenseText)
+	}
+}
+
+func TestGetLicenseFileStreamsTarball(t *testing.T) {
+	tarball := buildTarball(t, map[string]string{
+		"package/LICENSE": "License text",
+	})
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(tarball)
+	}))
+	defer srv.Close()
+
+	cfg := NewRegistryConfig()
+	cfg.SetRegistry(srv.URL)
+	c := NewClient(cfg)
+	text, err := c.GetLicenseFile(context.Background(), srv.URL+"/a/-/a-1.0.0.tgz", "LICENSE")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if text != "License text" {
+		t.Errorf("expected %q, got %q", "License text", text)
+	}
+	if n := cfg.Stats.BytesDownloaded(); n <= 0 || n > int64(len(tarball)) {
+		t.Errorf("expected up to %d bytes downloaded, got %d", len(tarball), n)
+	}
+
+	if _, err := c.GetLicenseFile(context.Background(), srv.URL+"/a/-/a-1.0.0.tgz", "MISSING"); err == nil {
+		t.Errorf("expected error for missing file, got nil")
+	}
+}
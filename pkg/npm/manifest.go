@@ -3,7 +3,13 @@
 
 package npm
 
-import "encoding/json"
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
 
 // ParseManifest takes a byte slice (from reading a
 // package.json file), parses it, and returns a corresponding
@@ -22,3 +28,314 @@ func ParseLockManifest(js []byte) (*PackageLockManifest, error) {
 	err := json.Unmarshal(js, &lockManifest)
 	return &lockManifest, err
 }
+
+// ParseLockDependencies takes a byte slice (from reading a
+// package-lock.json or npm-shrinkwrap.json file, a yarn.lock
+// file from either Yarn classic or Yarn Berry, or a
+// pnpm-lock.yaml file), detects which kind of lockfile it is,
+// parses it, and returns its dependencies in the form consumed
+// by GetAllDependencies. The PackageManifest is used to resolve
+// the root package's dependencies for lockfiles that don't
+// record them. Likewise, the workspaces map (as returned by
+// LoadWorkspaceManifests) is used to add an entry for each
+// workspace package, keyed by its path and with IsWorkspace set.
+func ParseLockDependencies(b []byte, manifest *PackageManifest, workspaces map[string]*PackageManifest) (map[string]*PackageLockDependency, error) {
+	trimmed := bytes.TrimSpace(b)
+
+	switch {
+	case bytes.HasPrefix(trimmed, []byte("{")):
+		lockManifest, err := ParseLockManifest(b)
+		if err != nil {
+			return nil, err
+		}
+		return lockManifest.GetLockDependencies(workspaces), nil
+
+	case bytes.HasPrefix(trimmed, []byte("lockfileVersion:")):
+		pl, err := ParsePnpmLock(b)
+		if err != nil {
+			return nil, err
+		}
+		return pl.GetLockDependencies(workspaces), nil
+
+	case bytes.Contains(trimmed, []byte("__metadata:")):
+		yl, err := ParseYarnBerryLock(b)
+		if err != nil {
+			return nil, err
+		}
+		return yl.GetLockDependencies(manifest, workspaces), nil
+
+	case bytes.Contains(trimmed, []byte("# yarn lockfile v1")):
+		yl, err := ParseYarnLock(b)
+		if err != nil {
+			return nil, err
+		}
+		return yl.GetLockDependencies(manifest, workspaces), nil
+
+	default:
+		return nil, fmt.Errorf("unrecognized lockfile format")
+	}
+}
+
+// GetLockDependencies returns every installed dependency recorded
+// in the PackageLockManifest, in the form consumed by
+// GetAllDependencies. The returned map is keyed by install path,
+// e.g. "node_modules/foo/node_modules/bar", so that several
+// versions of the same package can be installed side by side.
+// Each entry has its Name and InstalledDependencies filled in,
+// the latter by following node's module resolution from that
+// entry's location. Both use the real package name for aliases,
+// which are installed under a different name.
+//
+// The map also contains an entry for the root package under the
+// empty key "", whose InstalledDependencies records which version
+// of each package is visible from the top level; and an entry for
+// each workspace package, keyed by its path relative to the root.
+//
+// For lockfileVersion 1, entries are taken from the "dependencies"
+// object, walking nested "dependencies" recursively. For
+// lockfileVersion 2 and 3, they are taken from the "packages"
+// object, since version 3 lockfiles omit "dependencies" entirely.
+func (lm *PackageLockManifest) GetLockDependencies(workspaces map[string]*PackageManifest) map[string]*PackageLockDependency {
+	deps := map[string]*PackageLockDependency{}
+
+	if lm.LockfileVersion < 2 || len(lm.Packages) == 0 {
+		addNestedLockDependencies(deps, "", lm.Dependencies)
+	} else {
+		for path, p := range lm.Packages {
+			name := getPackageNameFromPath(path)
+			if name == "" {
+				continue
+			}
+			// skip symlinks (e.g., to workspace packages), which
+			// aren't retrievable from the registry
+			if p.Link {
+				continue
+			}
+
+			d := convertLockPackage(p)
+			d.Name = name
+			// aliased packages ("foo": "npm:bar@1.0.0") record the
+			// real package name separately
+			if p.Name != "" {
+				d.Name = p.Name
+			}
+			deps[path] = d
+		}
+	}
+
+	// add workspace packages, whose own node_modules directories
+	// may contain packages that weren't hoisted to the top level
+	for path, wm := range workspaces {
+		deps[path] = &PackageLockDependency{
+			Name:        wm.Name,
+			Version:     wm.Version,
+			Requires:    wm.getAllRequires(),
+			IsWorkspace: true,
+		}
+	}
+
+	// resolve each entry's requirements to installed copies
+	for path, d := range deps {
+		d.InstalledDependencies = map[string]string{}
+		for reqName := range d.Requires {
+			if inst, ok := resolveInstallPath(deps, path, reqName); ok {
+				d.InstalledDependencies[reqName] = installedVersion(reqName, inst.Name, inst.Version)
+			}
+		}
+	}
+
+	// and record what's visible from the root package
+	root := &PackageLockDependency{
+		Name:                  lm.Name,
+		Version:               lm.Version,
+		InstalledDependencies: map[string]string{},
+	}
+	for path, d := range deps {
+		if isTopLevelPath(path) {
+			instName := getPackageNameFromPath(path)
+			root.InstalledDependencies[instName] = installedVersion(instName, d.Name, d.Version)
+		}
+	}
+	deps[""] = root
+
+	// finally, record bundled packages against the package that
+	// bundles them, i.e. the one whose node_modules they are in
+	for path, d := range deps {
+		if path == "" || !d.Bundled {
+			continue
+		}
+		if parent, ok := deps[getParentPath(path)]; ok {
+			parent.BundledDependencies = mergeNames(parent.BundledDependencies, []string{getPackageNameFromPath(path)})
+		}
+	}
+
+	return deps
+}
+
+// addNestedLockDependencies adds the v1 lockfile entries in
+// nested, which are installed in the node_modules directory
+// under parentPath, to deps; and then recursively does the same
+// for each of their own nested dependencies.
+func addNestedLockDependencies(deps map[string]*PackageLockDependency, parentPath string, nested map[string]*PackageLockDependency) {
+	for name, d := range nested {
+		path := "node_modules/" + name
+		if parentPath != "" {
+			path = parentPath + "/" + path
+		}
+
+		d.Name = name
+		// aliased packages record the real package name in their
+		// version, e.g. "npm:bar@1.0.0"
+		if strings.HasPrefix(d.Version, "npm:") {
+			d.Name, d.Version = ParseInstalledVersion(name, d.Version)
+		}
+		deps[path] = d
+		addNestedLockDependencies(deps, path, d.Dependencies)
+	}
+}
+
+// resolveInstallPath finds the copy of package reqName that
+// node would load from the package installed at path, by
+// checking path's own node_modules directory and then each
+// ancestor's in turn.
+func resolveInstallPath(deps map[string]*PackageLockDependency, path string, reqName string) (*PackageLockDependency, bool) {
+	for {
+		candidate := "node_modules/" + reqName
+		if path != "" {
+			candidate = path + "/" + candidate
+		}
+		if d, ok := deps[candidate]; ok {
+			return d, true
+		}
+
+		if path == "" {
+			return nil, false
+		}
+		path = getParentPath(path)
+	}
+}
+
+// getParentPath returns the install path of the package whose
+// node_modules directory contains the package installed at path,
+// or "" for the root package.
+func getParentPath(path string) string {
+	i := strings.LastIndex(path, "/node_modules/")
+	if i < 0 {
+		return ""
+	}
+	return path[:i]
+}
+
+// getPackageNameFromPath takes an install path key from the
+// "packages" object in a package-lock.json file and returns the
+// name of the package installed there: the portion following
+// the last "node_modules/". It returns an empty string for the
+// root package ("") and for other paths that aren't under a
+// node_modules directory, such as workspace packages.
+func getPackageNameFromPath(path string) string {
+	i := strings.LastIndex(path, "node_modules/")
+	if i < 0 || (i > 0 && path[i-1] != '/') {
+		return ""
+	}
+	return path[i+len("node_modules/"):]
+}
+
+// isTopLevelPath returns whether the install path is directly
+// within the root package's node_modules directory.
+func isTopLevelPath(path string) bool {
+	return strings.HasPrefix(path, "node_modules/") &&
+		strings.Count(path, "node_modules/") == 1
+}
+
+// convertLockPackage translates a v2 / v3 "packages" entry into
+// the equivalent v1 PackageLockDependency.
+func convertLockPackage(p *PackageLockPackage) *PackageLockDependency {
+	d := &PackageLockDependency{
+		Version:   p.Version,
+		Resolved:  p.Resolved,
+		Integrity: p.Integrity,
+		Dev:       p.Dev,
+		Bundled:   p.InBundle,
+	}
+
+	// v2 / v3 "dependencies" correspond to v1 "requires", and
+	// optional dependencies are listed separately
+	if len(p.Dependencies) > 0 || len(p.OptionalDependencies) > 0 {
+		d.Requires = map[string]string{}
+		for k, v := range p.Dependencies {
+			d.Requires[k] = v
+		}
+		for k, v := range p.OptionalDependencies {
+			d.Requires[k] = v
+		}
+	}
+
+	return d
+}
+
+// getAllRequires returns all of the dependencies that are
+// installed for a package being developed locally (such as the
+// root or a workspace package), including dev dependencies.
+func (pm *PackageManifest) getAllRequires() map[string]string {
+	reqs := map[string]string{}
+	for _, m := range []map[string]string{pm.Dependencies, pm.DevDependencies} {
+		for k, v := range m {
+			reqs[k] = v
+		}
+	}
+	return reqs
+}
+
+// GetBundledDependencies returns the sorted names of the
+// dependencies listed in the PackageManifest's
+// "bundleDependencies" (or "bundledDependencies") field.
+func (pm *PackageManifest) GetBundledDependencies() []string {
+	return mergeNames(
+		parseBundledDependencies(pm.BundleDependencies, pm.Dependencies),
+		parseBundledDependencies(pm.BundledDependencies, pm.Dependencies),
+	)
+}
+
+// parseBundledDependencies takes the value of a
+// "bundleDependencies" field, which is either an array of
+// names or a boolean, and returns the names it refers to. If it
+// is true, all of the package's dependencies are bundled.
+func parseBundledDependencies(bundle interface{}, deps map[string]string) []string {
+	names := []string{}
+	switch b := bundle.(type) {
+	case []interface{}:
+		for _, v := range b {
+			if name, ok := v.(string); ok {
+				names = append(names, name)
+			}
+		}
+	case bool:
+		if b {
+			for name := range deps {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+// mergeNames returns the sorted union of two lists of names.
+// It returns nil if both are empty.
+func mergeNames(a []string, b []string) []string {
+	if len(a) == 0 && len(b) == 0 {
+		return nil
+	}
+
+	seen := map[string]bool{}
+	names := []string{}
+	for _, list := range [][]string{a, b} {
+		for _, name := range list {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
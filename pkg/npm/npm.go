@@ -10,11 +10,25 @@ package npm
 // response to a GET call for a particular version of an
 // NPM package.
 type RegistryVersion struct {
-	Name            string            `json:"name"`
-	Version         string            `json:"version"`
-	License         interface{}       `json:"license,omitempty"`
+	Name    string      `json:"name"`
+	Version string      `json:"version"`
+	License interface{} `json:"license,omitempty"`
+	// Licenses is the legacy form of License: an array of objects
+	// with a "type" field, or of strings.
+	Licenses        interface{}       `json:"licenses,omitempty"`
 	Dependencies    map[string]string `json:"dependencies,omitempty"`
 	DevDependencies map[string]string `json:"devDependencies,omitempty"`
+	// bundled dependencies may be listed under either spelling,
+	// as either an array of names or true (meaning all of them)
+	BundleDependencies  interface{}   `json:"bundleDependencies,omitempty"`
+	BundledDependencies interface{}   `json:"bundledDependencies,omitempty"`
+	Dist                *RegistryDist `json:"dist,omitempty"`
+}
+
+// RegistryDist describes where a package version's published
+// tarball can be downloaded from.
+type RegistryDist struct {
+	Tarball string `json:"tarball"`
 }
 
 // RegistryScopedPackage handles the multiple versions that
@@ -34,16 +48,64 @@ type Dependency struct {
 	DevDependencies map[string]string `json:"devDependencies,omitempty"`
 	IsDirectDep     bool              `json:"isDirectDep,omitempty"`
 	IsDirectDevDep  bool              `json:"isDirectDevDep,omitempty"`
+	// InstalledDependencies maps the name of each dependency to
+	// the version that was actually installed for it, from the
+	// perspective of this package's location(s) in the tree. For
+	// aliases, the version is given together with the real package
+	// name, e.g. "npm:bar@1.0.0"; see ParseInstalledVersion.
+	InstalledDependencies map[string]string `json:"installedDependencies,omitempty"`
+	// OtherInstalledDependencies lists any other versions that a
+	// dependency was resolved to, in the same form, by copies of
+	// this package installed at other locations in the tree.
+	OtherInstalledDependencies map[string][]string `json:"otherInstalledDependencies,omitempty"`
+	// BundledDependencies lists the names of dependencies that
+	// are bundled within this package's published tarball.
+	BundledDependencies []string `json:"bundledDependencies,omitempty"`
+	// Error, if not empty, is the reason this package's data could
+	// not be retrieved, in which case its License is NOASSERTION.
+	Error string `json:"error,omitempty"`
+	// RawLicense is the registry's original license data, if it
+	// wasn't just a string: e.g. an object with a "type" field, or
+	// a legacy "licenses" array.
+	RawLicense interface{} `json:"rawLicense,omitempty"`
+	// OriginalLicense is the license as declared in the package's
+	// data, if License is a normalized form of it.
+	OriginalLicense string `json:"originalLicense,omitempty"`
+	// LicenseFile is the file named by a license declared as
+	// "SEE LICENSE IN <file>", and LicenseText is that file's text,
+	// if it could be retrieved.
+	LicenseFile string `json:"licenseFile,omitempty"`
+	LicenseText string `json:"licenseText,omitempty"`
+	// Tarball is the URL of the package's published tarball.
+	Tarball string `json:"tarball,omitempty"`
 }
 
-// DependencyResults maps a dependency's name to its
-// Dependency, which itself contains the corresponding
-// version-specific details.
+// DependencyResults maps a dependency's name and version (in
+// the form returned by DependencyKey) to its Dependency, which
+// itself contains the corresponding version-specific details.
+// Results files saved by older versions of npm-spdx are keyed
+// by name alone.
 type DependencyResults struct {
-	Name    string                 `json:"name"`
-	Version string                 `json:"version"`
-	License string                 `json:"license,omitempty"`
-	Results map[string]*Dependency `json:"results"`
+	Name                string                 `json:"name"`
+	Version             string                 `json:"version"`
+	License             string                 `json:"license,omitempty"`
+	BundledDependencies []string               `json:"bundledDependencies,omitempty"`
+	Workspaces          []*Workspace           `json:"workspaces,omitempty"`
+	Results             map[string]*Dependency `json:"results"`
+}
+
+// Workspace contains the details of one workspace package
+// within a monorepo, read from its local package.json file
+// rather than from the NPM API. Path is its directory relative
+// to the root package.
+type Workspace struct {
+	Name                  string            `json:"name"`
+	Version               string            `json:"version"`
+	License               string            `json:"license,omitempty"`
+	Path                  string            `json:"path"`
+	Dependencies          map[string]string `json:"dependencies,omitempty"`
+	DevDependencies       map[string]string `json:"devDependencies,omitempty"`
+	InstalledDependencies map[string]string `json:"installedDependencies,omitempty"`
 }
 
 // PackageManifest represents the data from a package.json
@@ -54,22 +116,148 @@ type PackageManifest struct {
 	License         string            `json:"license,omitempty"`
 	Dependencies    map[string]string `json:"dependencies,omitempty"`
 	DevDependencies map[string]string `json:"devDependencies,omitempty"`
+	// bundled dependencies may be listed under either spelling,
+	// as either an array of names or true (meaning all of them)
+	BundleDependencies  interface{} `json:"bundleDependencies,omitempty"`
+	BundledDependencies interface{} `json:"bundledDependencies,omitempty"`
+	// workspaces may be either an array of glob patterns, or an
+	// object with those patterns in its "packages" field
+	Workspaces interface{} `json:"workspaces,omitempty"`
 }
 
 // PackageLockDependency represents an entry within the
-// "dependencies" object in a package-lock.json file.
+// "dependencies" object in a package-lock.json or
+// npm-shrinkwrap.json file. Entries may themselves contain
+// nested "dependencies" for packages installed in their own
+// node_modules directory.
 type PackageLockDependency struct {
-	Version   string            `json:"version"`
-	Resolved  string            `json:"resolved"`
-	Integrity string            `json:"integrity"`
-	Dev       bool              `json:"dev,omitempty"`
-	Requires  map[string]string `json:"requires,omitempty"`
+	Version      string                            `json:"version"`
+	Resolved     string                            `json:"resolved"`
+	Integrity    string                            `json:"integrity"`
+	Dev          bool                              `json:"dev,omitempty"`
+	Bundled      bool                              `json:"bundled,omitempty"`
+	Requires     map[string]string                 `json:"requires,omitempty"`
+	Dependencies map[string]*PackageLockDependency `json:"dependencies,omitempty"`
+
+	// Name, InstalledDependencies, BundledDependencies and
+	// IsWorkspace are not parsed from the lockfile; they are
+	// filled in by GetLockDependencies. InstalledDependencies is
+	// keyed by the name each dependency is installed under, with
+	// values in the same form as Dependency's.
+	Name                  string            `json:"-"`
+	InstalledDependencies map[string]string `json:"-"`
+	BundledDependencies   []string          `json:"-"`
+	IsWorkspace           bool              `json:"-"`
+}
+
+// PackageLockPackage represents an entry within the
+// "packages" object in a package-lock.json file with
+// lockfileVersion 2 or 3. Entries are keyed by their install
+// path, e.g. "node_modules/foo" or
+// "node_modules/foo/node_modules/bar".
+type PackageLockPackage struct {
+	Name                 string            `json:"name,omitempty"`
+	Version              string            `json:"version"`
+	Resolved             string            `json:"resolved,omitempty"`
+	Integrity            string            `json:"integrity,omitempty"`
+	Link                 bool              `json:"link,omitempty"`
+	Dev                  bool              `json:"dev,omitempty"`
+	InBundle             bool              `json:"inBundle,omitempty"`
+	Optional             bool              `json:"optional,omitempty"`
+	Dependencies         map[string]string `json:"dependencies,omitempty"`
+	OptionalDependencies map[string]string `json:"optionalDependencies,omitempty"`
 }
 
 // PackageLockManifest represents the data from a
-// package-lock.json file.
+// package-lock.json or npm-shrinkwrap.json file, which share
+// the same format. Version 1 lockfiles use the
+// "dependencies" object; version 2 lockfiles contain both
+// "dependencies" and "packages", and version 3 lockfiles
+// contain only "packages".
 type PackageLockManifest struct {
-	Name         string                            `json:"name"`
-	Version      string                            `json:"version"`
-	Dependencies map[string]*PackageLockDependency `json:"dependencies,omitempty"`
+	Name            string                            `json:"name"`
+	Version         string                            `json:"version"`
+	LockfileVersion int                               `json:"lockfileVersion"`
+	Dependencies    map[string]*PackageLockDependency `json:"dependencies,omitempty"`
+	Packages        map[string]*PackageLockPackage    `json:"packages,omitempty"`
+}
+
+// YarnLockEntry represents one entry in a yarn.lock file. A
+// single entry may satisfy several "name@range" specifiers.
+// Protocol records where the entry's package comes from, e.g.
+// "npm" for the registry, or "file", "git" or "workspace". For
+// Yarn Berry (v2+) lockfiles, Resolved holds the entry's
+// "resolution" field, Integrity holds its "checksum", and
+// Protocol is the resolution's protocol; for Yarn classic
+// lockfiles, Protocol is worked out from the specifiers' ranges
+// and the "resolved" URL.
+type YarnLockEntry struct {
+	Name                 string
+	Specifiers           []string
+	Version              string
+	Resolved             string
+	Integrity            string
+	Protocol             string
+	LinkType             string
+	Dependencies         map[string]string
+	OptionalDependencies map[string]string
+}
+
+// YarnLock represents the data from a yarn.lock file, mapping
+// each "name@range" specifier to the entry that it was resolved
+// to.
+type YarnLock struct {
+	Entries map[string]*YarnLockEntry
+}
+
+// PnpmLock represents the data from a pnpm-lock.yaml file.
+// Lockfiles for monorepos (and all lockfiles from lockfileVersion
+// 9) list each workspace project under "importers", keyed by its
+// directory relative to the lockfile; older single-project
+// lockfiles record the root project's fields at the top level.
+// Lockfiles from lockfileVersion 9 split each package's metadata
+// ("packages") from its resolved dependencies ("snapshots").
+type PnpmLock struct {
+	LockfileVersion string                   `yaml:"lockfileVersion"`
+	Importers       map[string]*PnpmImporter `yaml:"importers,omitempty"`
+	PnpmImporter    `yaml:",inline"`
+	Packages        map[string]*PnpmPackage `yaml:"packages,omitempty"`
+	Snapshots       map[string]*PnpmPackage `yaml:"snapshots,omitempty"`
+}
+
+// PnpmImporter represents one workspace project within a
+// pnpm-lock.yaml file, and the dependencies it was resolved to.
+type PnpmImporter struct {
+	Specifiers           map[string]string                  `yaml:"specifiers,omitempty"`
+	Dependencies         map[string]*PnpmImporterDependency `yaml:"dependencies,omitempty"`
+	DevDependencies      map[string]*PnpmImporterDependency `yaml:"devDependencies,omitempty"`
+	OptionalDependencies map[string]*PnpmImporterDependency `yaml:"optionalDependencies,omitempty"`
+}
+
+// PnpmImporterDependency represents one of an importer's
+// dependencies. Version is a reference to an entry in the
+// lockfile's packages, e.g. "4.3.4", "1.0.0(bar@2.0.0)" or
+// "link:packages/a".
+type PnpmImporterDependency struct {
+	Specifier string `yaml:"specifier,omitempty"`
+	Version   string `yaml:"version"`
+}
+
+// PnpmPackage represents an entry within the "packages" or
+// "snapshots" object in a pnpm-lock.yaml file. Dependencies map
+// each dependency's name to a reference to another entry, in the
+// same form as PnpmImporterDependency's Version.
+type PnpmPackage struct {
+	Name                 string            `yaml:"name,omitempty"`
+	Version              string            `yaml:"version,omitempty"`
+	Resolution           PnpmResolution    `yaml:"resolution,omitempty"`
+	Dependencies         map[string]string `yaml:"dependencies,omitempty"`
+	OptionalDependencies map[string]string `yaml:"optionalDependencies,omitempty"`
+	Dev                  bool              `yaml:"dev,omitempty"`
+}
+
+// PnpmResolution represents where a pnpm package was obtained.
+type PnpmResolution struct {
+	Integrity string `yaml:"integrity,omitempty"`
+	Tarball   string `yaml:"tarball,omitempty"`
 }
@@ -0,0 +1,262 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright The Linux Foundation and npm-spdx contributors.
+
+package npm
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// DefaultRegistryURL is the public NPM registry, used unless a
+// different one is configured.
+const DefaultRegistryURL = "https://registry.npmjs.org/"
+
+// RegistryConfig describes which registry to query for each
+// package, and how to authenticate to it.
+type RegistryConfig struct {
+	// Registry is the URL of the registry used for unscoped
+	// packages, and for scoped packages without their own registry.
+	Registry string
+	// ScopeRegistries maps a scope (e.g. "@corp") to the URL of
+	// the registry used for packages in that scope.
+	ScopeRegistries map[string]string
+	// Auth maps a registry's URL without its scheme, e.g.
+	// "//registry.example.com/npm/", to its credentials.
+	Auth map[string]*RegistryAuth
+	// DefaultAuth, if not nil, holds the credentials given in an
+	// .npmrc file without a registry URL prefix. As with npm, they
+	// are used for Registry, unless Auth has credentials for it.
+	DefaultAuth *RegistryAuth
+	// MaxRetries is the number of times a failed request is
+	// retried, if the failure may be temporary.
+	MaxRetries int
+	// RetryBaseDelay is the approximate delay before the first
+	// retry, which doubles for each subsequent retry.
+	RetryBaseDelay time.Duration
+	// Cache, if not nil, stores registry data on disk between runs.
+	Cache *Cache
+	// Stats, if not nil, counts the requests made to the registry
+	// and the data transferred.
+	Stats *TransferStats
+}
+
+// RegistryAuth contains the credentials for one registry, from
+// the "_authToken", "_auth", or "username" and "_password" entries
+// in an .npmrc file.
+type RegistryAuth struct {
+	Token    string
+	Auth     string
+	Username string
+	Password string
+}
+
+// NewRegistryConfig returns a RegistryConfig that uses the
+// public NPM registry for all packages, without credentials,
+// and retries failed requests up to 5 times.
+func NewRegistryConfig() *RegistryConfig {
+	return &RegistryConfig{
+		Registry:        DefaultRegistryURL,
+		ScopeRegistries: map[string]string{},
+		Auth:            map[string]*RegistryAuth{},
+		MaxRetries:      5,
+		RetryBaseDelay:  500 * time.Millisecond,
+		Stats:           &TransferStats{},
+	}
+}
+
+// LoadRegistryConfig returns a RegistryConfig built from the
+// user-level .npmrc file (in the home directory) and then the
+// project-level .npmrc file (in projectDir), with the latter's
+// settings taking precedence. Missing files are ignored.
+func LoadRegistryConfig(projectDir string) (*RegistryConfig, error) {
+	cfg := NewRegistryConfig()
+
+	paths := []string{}
+	if home, err := os.UserHomeDir(); err == nil {
+		paths = append(paths, filepath.Join(home, ".npmrc"))
+	}
+	paths = append(paths, filepath.Join(projectDir, ".npmrc"))
+
+	for _, path := range paths {
+		b, err := ioutil.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s: %v", path, err)
+		}
+		cfg.ParseNpmrc(b)
+	}
+
+	return cfg, nil
+}
+
+// npmrcEnvVar matches environment variable references in .npmrc
+// values, e.g. "${NPM_TOKEN}".
+var npmrcEnvVar = regexp.MustCompile(`\$\{([^}]+)\}`)
+
+// ParseNpmrc takes a byte slice (from reading an .npmrc file),
+// parses its registry and credential settings, and adds them to
+// the RegistryConfig, replacing any existing values. Other
+// settings are ignored.
+func (cfg *RegistryConfig) ParseNpmrc(b []byte) {
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+
+		eq := strings.IndexByte(line, '=')
+		if eq < 0 {
+			continue
+		}
+		key := strings.TrimSpace(line[:eq])
+		val := strings.Trim(strings.TrimSpace(line[eq+1:]), `"'`)
+		val = npmrcEnvVar.ReplaceAllStringFunc(val, func(ref string) string {
+			return os.Getenv(npmrcEnvVar.FindStringSubmatch(ref)[1])
+		})
+
+		switch {
+		case isAuthSetting(key):
+			// credentials without a registry prefix, e.g. "_authToken"
+			if cfg.DefaultAuth == nil {
+				cfg.DefaultAuth = &RegistryAuth{}
+			}
+			cfg.DefaultAuth.set(key, val)
+
+		case key == "registry":
+			cfg.Registry = normalizeRegistryURL(val)
+
+		case strings.HasPrefix(key, "@") && strings.HasSuffix(key, ":registry"):
+			cfg.ScopeRegistries[strings.TrimSuffix(key, ":registry")] = normalizeRegistryURL(val)
+
+		case strings.HasPrefix(key, "//"):
+			// per-registry setting, e.g. "//host/path/:_authToken"
+			i := strings.LastIndex(key, ":")
+			if i < 0 {
+				continue
+			}
+			nerfDart, setting := key[:i], key[i+1:]
+			if !isAuthSetting(setting) {
+				continue
+			}
+			auth, ok := cfg.Auth[nerfDart]
+			if !ok {
+				auth = &RegistryAuth{}
+				cfg.Auth[nerfDart] = auth
+			}
+			auth.set(setting, val)
+		}
+	}
+}
+
+// isAuthSetting returns whether an .npmrc setting's name (without
+// any registry URL prefix) is one of the credentials that
+// RegistryAuth holds.
+func isAuthSetting(setting string) bool {
+	switch setting {
+	case "_authToken", "_auth", "username", "_password":
+		return true
+	}
+	return false
+}
+
+// set sets the credential with the specified .npmrc setting name.
+func (auth *RegistryAuth) set(setting string, val string) {
+	switch setting {
+	case "_authToken":
+		auth.Token = val
+	case "_auth":
+		auth.Auth = val
+	case "username":
+		auth.Username = val
+	case "_password":
+		auth.Password = val
+	}
+}
+
+// SetRegistry sets the registry used for unscoped packages, e.g.
+// as overridden on the command line. Scoped packages whose scope
+// has its own registry still use that one.
+func (cfg *RegistryConfig) SetRegistry(u string) {
+	cfg.Registry = normalizeRegistryURL(u)
+}
+
+// getNerfDart returns a registry URL without its scheme, in the
+// form used to key per-registry .npmrc settings, e.g.
+// "//registry.example.com/npm/".
+func getNerfDart(u string) string {
+	if i := strings.Index(u, "//"); i >= 0 {
+		u = u[i:]
+	}
+	return normalizeRegistryURL(u)
+}
+
+// normalizeRegistryURL ensures that a registry URL ends in "/".
+func normalizeRegistryURL(u string) string {
+	if !strings.HasSuffix(u, "/") {
+		u += "/"
+	}
+	return u
+}
+
+// GetRegistryURL returns the URL of the registry to use for the
+// specified package, taking its scope into account.
+func (cfg *RegistryConfig) GetRegistryURL(pkg string) string {
+	if strings.HasPrefix(pkg, "@") {
+		if i := strings.IndexByte(pkg, '/'); i > 0 {
+			if reg, ok := cfg.ScopeRegistries[pkg[:i]]; ok {
+				return reg
+			}
+		}
+	}
+	return cfg.Registry
+}
+
+// authorize adds an Authorization header to the request, using
+// the credentials for the most specific registry URL that
+// matches it, if any.
+func (cfg *RegistryConfig) authorize(req *http.Request) {
+	target := "//" + req.URL.Host + req.URL.EscapedPath()
+
+	var best *RegistryAuth
+	bestLen := 0
+	for nerfDart, auth := range cfg.Auth {
+		prefix := normalizeRegistryURL(nerfDart)
+		if strings.HasPrefix(target, prefix) && len(prefix) > bestLen {
+			best = auth
+			bestLen = len(prefix)
+		}
+	}
+	if best == nil && cfg.DefaultAuth != nil && strings.HasPrefix(target, getNerfDart(cfg.Registry)) {
+		best = cfg.DefaultAuth
+	}
+	if best == nil {
+		return
+	}
+
+	switch {
+	case best.Token != "":
+		req.Header.Set("Authorization", "Bearer "+best.Token)
+	case best.Auth != "":
+		req.Header.Set("Authorization", "Basic "+best.Auth)
+	case best.Username != "" && best.Password != "":
+		// the .npmrc password is itself base64-encoded
+		pw, err := base64.StdEncoding.DecodeString(best.Password)
+		if err != nil {
+			return
+		}
+		req.SetBasicAuth(best.Username, string(pw))
+	}
+}
@@ -0,0 +1,105 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright The Linux Foundation and npm-spdx contributors.
+
+package npm
+
+import (
+	"net/http"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestParseNpmrc(t *testing.T) {
+	os.Setenv("NPM_SPDX_TEST_TOKEN", "secret")
+	defer os.Unsetenv("NPM_SPDX_TEST_TOKEN")
+
+	cfg := NewRegistryConfig()
+	cfg.ParseNpmrc([]byte(`
+# comment
+; also a comment
+registry=https://mirror.example.com/npm
+@corp:registry = "https://corp.example.com/"
+//corp.example.com/:_authToken=${NPM_SPDX_TEST_TOKEN}
+//mirror.example.com/npm/:username=user
+//mirror.example.com/npm/:_password=cGFzcw==
+//mirror.example.com/npm/:always-auth=true
+_auth=ZGVmYXVsdDphdXRo
+strict-ssl=false
+not a setting
+`))
+
+	if cfg.Registry != "https://mirror.example.com/npm/" {
+		t.Errorf("expected registry https://mirror.example.com/npm/, got %s", cfg.Registry)
+	}
+	if !reflect.DeepEqual(cfg.ScopeRegistries, map[string]string{"@corp": "https://corp.example.com/"}) {
+		t.Errorf("expected @corp scope registry, got %v", cfg.ScopeRegistries)
+	}
+	expectedAuth := map[string]*RegistryAuth{
+		"//corp.example.com/":       {Token: "secret"},
+		"//mirror.example.com/npm/": {Username: "user", Password: "cGFzcw=="},
+	}
+	if !reflect.DeepEqual(cfg.Auth, expectedAuth) {
+		t.Errorf("expected auth %v, got %v", expectedAuth, cfg.Auth)
+	}
+	if !reflect.DeepEqual(cfg.DefaultAuth, &RegistryAuth{Auth: "ZGVmYXVsdDphdXRo"}) {
+		t.Errorf("expected default auth, got %v", cfg.DefaultAuth)
+	}
+}
+
+func TestGetRegistryURL(t *testing.T) {
+	cfg := NewRegistryConfig()
+	cfg.ParseNpmrc([]byte("@corp:registry=https://corp.example.com/\n"))
+	cfg.SetRegistry("https://mirror.example.com")
+
+	for _, tc := range []struct {
+		pkg string
+		url string
+	}{
+		{"debug", "https://mirror.example.com/"},
+		{"@babel/core", "https://mirror.example.com/"},
+		{"@corp/lib", "https://corp.example.com/"},
+	} {
+		if url := cfg.GetRegistryURL(tc.pkg); url != tc.url {
+			t.Errorf("%s: expected %s, got %s", tc.pkg, tc.url, url)
+		}
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		npmrc  string
+		url    string
+		header string
+	}{
+		{"token", "//registry.example.com/:_authToken=abc", "https://registry.example.com/debug/4.1.1", "Bearer abc"},
+		{"auth", "//registry.example.com/:_auth=dXNlcjpwYXNz", "https://registry.example.com/debug/4.1.1", "Basic dXNlcjpwYXNz"},
+		{"username and password", "//registry.example.com/:username=user\n//registry.example.com/:_password=cGFzcw==",
+			"https://registry.example.com/debug/4.1.1", "Basic dXNlcjpwYXNz"},
+		{"other host", "//registry.example.com/:_authToken=abc", "https://other.example.com/debug/4.1.1", ""},
+		{"path prefix must match", "//registry.example.com/npm/:_authToken=abc", "https://registry.example.com/debug/4.1.1", ""},
+		{"most specific prefix", "//registry.example.com/:_authToken=abc\n//registry.example.com/npm/:_authToken=def",
+			"https://registry.example.com/npm/debug/4.1.1", "Bearer def"},
+		{"port is part of the host", "//registry.example.com:8080/:_authToken=abc", "https://registry.example.com/debug/4.1.1", ""},
+		{"unprefixed for default registry", "registry=https://registry.example.com/\n_authToken=abc",
+			"https://registry.example.com/debug/4.1.1", "Bearer abc"},
+		{"unprefixed not for other registries", "registry=https://registry.example.com/\n_authToken=abc",
+			"https://corp.example.com/@corp%2flib/1.0.0", ""},
+		{"prefixed preferred over unprefixed", "registry=https://registry.example.com/\n_authToken=abc\n//registry.example.com/:_authToken=def",
+			"https://registry.example.com/debug/4.1.1", "Bearer def"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := NewRegistryConfig()
+			cfg.ParseNpmrc([]byte(tc.npmrc))
+			req, err := http.NewRequest("GET", tc.url, nil)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			cfg.authorize(req)
+			if h := req.Header.Get("Authorization"); h != tc.header {
+				t.Errorf("expected Authorization %q, got %q", tc.header, h)
+			}
+		})
+	}
+}
@@ -0,0 +1,277 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright The Linux Foundation and npm-spdx contributors.
+
+package npm
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// ParsePnpmLock takes a byte slice (from reading a
+// pnpm-lock.yaml file), parses its YAML, and returns a
+// corresponding PnpmLock object.
+func ParsePnpmLock(b []byte) (*PnpmLock, error) {
+	pl := &PnpmLock{}
+	err := yaml.Unmarshal(b, pl)
+	if err != nil {
+		return nil, fmt.Errorf("error unmarshalling from YAML: %v", err)
+	}
+	return pl, nil
+}
+
+// UnmarshalYAML handles importer dependencies in both the
+// lockfileVersion 5 form (just the version reference) and the
+// lockfileVersion 6+ form (an object with specifier and version).
+func (d *PnpmImporterDependency) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err == nil {
+		d.Version = s
+		return nil
+	}
+
+	type plain PnpmImporterDependency
+	return unmarshal((*plain)(d))
+}
+
+// majorVersion returns the major part of the PnpmLock's
+// lockfileVersion, which determines the format of its package
+// keys: "/name/1.0.0_peer@2.0.0" for version 5,
+// "/name@1.0.0(peer@2.0.0)" for version 6 and
+// "name@1.0.0(peer@2.0.0)" for version 9.
+func (pl *PnpmLock) majorVersion() int {
+	v, err := strconv.ParseFloat(pl.LockfileVersion, 64)
+	if err != nil {
+		return 0
+	}
+	return int(v)
+}
+
+// rootImporter returns the importer for the root project.
+func (pl *PnpmLock) rootImporter() *PnpmImporter {
+	if imp, ok := pl.Importers["."]; ok {
+		return imp
+	}
+	return &pl.PnpmImporter
+}
+
+// parsePackageKey takes a key from the "packages" or "snapshots"
+// object and returns the name and version of the package it
+// refers to, without any peer dependency suffix. It returns
+// false if the key doesn't refer to a registry package (e.g.,
+// it was obtained from git or a local directory).
+func (pl *PnpmLock) parsePackageKey(key string) (string, string, bool) {
+	major := pl.majorVersion()
+	if major < 6 {
+		// "/name/1.0.0_peer@2.0.0" or "/@scope/name/1.0.0"
+		if !strings.HasPrefix(key, "/") {
+			return "", "", false
+		}
+		key = strings.TrimPrefix(key, "/")
+		i := strings.LastIndex(key, "/")
+		if i <= 0 {
+			return "", "", false
+		}
+		name, ver := key[:i], key[i+1:]
+		if j := strings.IndexByte(ver, '_'); j >= 0 {
+			ver = ver[:j]
+		}
+		return name, ver, ver != ""
+	}
+
+	// "/name@1.0.0(peer@2.0.0)" (v6) or "name@1.0.0(peer@2.0.0)" (v9)
+	if major < 9 {
+		if !strings.HasPrefix(key, "/") {
+			return "", "", false
+		}
+		key = strings.TrimPrefix(key, "/")
+	}
+	if i := strings.IndexByte(key, '('); i >= 0 {
+		key = key[:i]
+	}
+	name, ver := splitYarnSpecifier(key)
+	if name == "" || ver == "" || strings.ContainsAny(ver, ":/") {
+		return "", "", false
+	}
+	return name, ver, true
+}
+
+// getPackage returns the entry with the given key that records
+// its dependencies: from "snapshots" if present, otherwise from
+// "packages".
+func (pl *PnpmLock) getPackage(key string) (*PnpmPackage, bool) {
+	if p, ok := pl.Snapshots[key]; ok {
+		return p, true
+	}
+	p, ok := pl.Packages[key]
+	return p, ok
+}
+
+// resolveRef takes a dependency's name and its reference (as
+// found in an importer or package's dependencies) and returns
+// the key of the entry it refers to. It returns false for
+// workspace links and references that aren't in the lockfile.
+func (pl *PnpmLock) resolveRef(name string, ref string) (string, bool) {
+	if strings.HasPrefix(ref, "link:") {
+		return "", false
+	}
+
+	var key string
+	switch major := pl.majorVersion(); {
+	case major < 6:
+		key = "/" + name + "/" + ref
+	case major < 9:
+		key = "/" + name + "@" + ref
+	default:
+		key = name + "@" + ref
+	}
+	if _, ok := pl.getPackage(key); ok {
+		return key, true
+	}
+
+	// aliases ("foo": "npm:bar@1.0.0") refer to the real package's
+	// key directly
+	if _, ok := pl.getPackage(ref); ok {
+		return ref, true
+	}
+	return "", false
+}
+
+// getSortedKeys returns the keys of the entries in "packages" and
+// "snapshots", sorted and without duplicates.
+func (pl *PnpmLock) getSortedKeys() []string {
+	seen := map[string]bool{}
+	keys := []string{}
+	for _, m := range []map[string]*PnpmPackage{pl.Packages, pl.Snapshots} {
+		for key := range m {
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// GetLockDependencies returns every registry package version
+// recorded in the PnpmLock, in the form consumed by
+// GetAllDependencies. Entries are keyed by DependencyKey, so
+// that copies of a package which differ only in their peer
+// dependencies are combined; where those copies resolved a
+// dependency differently, the first in sorted key order is used.
+// Each entry's InstalledDependencies is resolved from the
+// references in its dependencies, and records aliased packages
+// under their real names (see ParseInstalledVersion).
+//
+// The map also contains an entry for the root package under the
+// empty key "", whose InstalledDependencies is resolved from the
+// root project's importer; and likewise an entry for each other
+// importer and each workspace package, keyed by its path relative
+// to the root. Importers' names and versions are taken from the
+// workspaces map, and are empty for importers not found there.
+func (pl *PnpmLock) GetLockDependencies(workspaces map[string]*PackageManifest) map[string]*PackageLockDependency {
+	deps := map[string]*PackageLockDependency{}
+
+	for _, key := range pl.getSortedKeys() {
+		name, ver, ok := pl.parsePackageKey(key)
+		if !ok {
+			continue
+		}
+
+		depKey := DependencyKey(name, ver)
+		d, ok := deps[depKey]
+		if !ok {
+			d = &PackageLockDependency{
+				Name:                  name,
+				Version:               ver,
+				Requires:              map[string]string{},
+				InstalledDependencies: map[string]string{},
+			}
+			if p := pl.Packages[key]; p != nil {
+				d.Integrity = p.Resolution.Integrity
+				d.Resolved = p.Resolution.Tarball
+				d.Dev = p.Dev
+			}
+			deps[depKey] = d
+		}
+
+		// entries with no fields at all are parsed as nil
+		p, _ := pl.getPackage(key)
+		if p == nil {
+			continue
+		}
+		for _, refs := range []map[string]string{p.Dependencies, p.OptionalDependencies} {
+			for reqName, ref := range refs {
+				if _, ok := d.Requires[reqName]; !ok {
+					d.Requires[reqName] = ref
+				}
+				pl.addInstalled(d.InstalledDependencies, reqName, ref)
+			}
+		}
+	}
+
+	deps[""] = pl.resolveImporter(pl.rootImporter())
+	for path, imp := range pl.Importers {
+		if path == "." {
+			continue
+		}
+		d := pl.resolveImporter(imp)
+		if wm, ok := workspaces[path]; ok {
+			d.Name = wm.Name
+			d.Version = wm.Version
+		}
+		d.IsWorkspace = true
+		deps[path] = d
+	}
+	for path, wm := range workspaces {
+		if _, ok := deps[path]; ok {
+			continue
+		}
+		deps[path] = &PackageLockDependency{
+			Name:                  wm.Name,
+			Version:               wm.Version,
+			InstalledDependencies: map[string]string{},
+			IsWorkspace:           true,
+		}
+	}
+
+	return deps
+}
+
+// resolveImporter returns an entry for a workspace project,
+// with its dependencies resolved from the importer's references.
+func (pl *PnpmLock) resolveImporter(imp *PnpmImporter) *PackageLockDependency {
+	d := &PackageLockDependency{
+		Requires:              map[string]string{},
+		InstalledDependencies: map[string]string{},
+	}
+	if imp == nil {
+		return d
+	}
+	for _, refs := range []map[string]*PnpmImporterDependency{imp.Dependencies, imp.DevDependencies, imp.OptionalDependencies} {
+		for reqName, ref := range refs {
+			d.Requires[reqName] = ref.Version
+			pl.addInstalled(d.InstalledDependencies, reqName, ref.Version)
+		}
+	}
+	return d
+}
+
+// addInstalled resolves a dependency reference and, if it refers
+// to a registry package, records its version in installed.
+func (pl *PnpmLock) addInstalled(installed map[string]string, reqName string, ref string) {
+	key, ok := pl.resolveRef(reqName, ref)
+	if !ok {
+		return
+	}
+	if name, ver, ok := pl.parsePackageKey(key); ok {
+		if _, exists := installed[reqName]; !exists {
+			installed[reqName] = installedVersion(reqName, name, ver)
+		}
+	}
+}
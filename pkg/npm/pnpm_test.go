@@ -0,0 +1,257 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright The Linux Foundation and npm-spdx contributors.
+
+package npm
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPnpmParsePackageKey(t *testing.T) {
+	for _, tc := range []struct {
+		lockfileVersion string
+		key             string
+		name            string
+		ver             string
+		ok              bool
+	}{
+		{"5.4", "/debug/4.3.4", "debug", "4.3.4", true},
+		{"5.4", "/debug/4.3.4_supports-color@8.1.1", "debug", "4.3.4", true},
+		{"5.4", "/@babel/core/7.2.2", "@babel/core", "7.2.2", true},
+		{"5.4", "github.com/foo/bar/abc123", "", "", false},
+		{"5.4", "/debug", "", "", false},
+		{"6.0", "/debug@4.3.4", "debug", "4.3.4", true},
+		{"6.0", "/debug@4.3.4(supports-color@8.1.1)", "debug", "4.3.4", true},
+		{"6.0", "/@babel/core@7.2.2", "@babel/core", "7.2.2", true},
+		{"6.0", "debug@4.3.4", "", "", false},
+		{"6.0", "file:packages/a", "", "", false},
+		{"9.0", "debug@4.3.4", "debug", "4.3.4", true},
+		{"9.0", "debug@4.3.4(supports-color@8.1.1)", "debug", "4.3.4", true},
+		{"9.0", "@babel/core@7.2.2", "@babel/core", "7.2.2", true},
+		{"9.0", "foo@file:packages/foo", "", "", false},
+		{"9.0", "bar@https://codeload.github.com/foo/bar/tar.gz/abc123", "", "", false},
+	} {
+		t.Run(tc.lockfileVersion+" "+tc.key, func(t *testing.T) {
+			pl := &PnpmLock{LockfileVersion: tc.lockfileVersion}
+			name, ver, ok := pl.parsePackageKey(tc.key)
+			if name != tc.name || ver != tc.ver || ok != tc.ok {
+				t.Errorf("expected (%q, %q, %v), got (%q, %q, %v)", tc.name, tc.ver, tc.ok, name, ver, ok)
+			}
+		})
+	}
+}
+
+func TestPnpmLockGetLockDependencies(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		lock     string
+		expected map[string]map[string]string
+	}{
+		{"v5", `lockfileVersion: 5.4
+specifiers:
+  debug: ^4.3.0
+  foo: npm:ms@^2.0.0
+dependencies:
+  debug: 4.3.4_supports-color@8.1.1
+  foo: /ms/2.0.0
+packages:
+  /debug/4.3.4_supports-color@7.2.0:
+    resolution: {integrity: sha512-a}
+    dependencies:
+      ms: 2.1.2
+      supports-color: 7.2.0
+  /debug/4.3.4_supports-color@8.1.1:
+    resolution: {integrity: sha512-a}
+    dependencies:
+      ms: 2.1.2
+      supports-color: 8.1.1
+  /ms/2.0.0:
+    resolution: {integrity: sha512-b}
+  /ms/2.1.2:
+    resolution: {integrity: sha512-c}
+  /supports-color/7.2.0:
+    resolution: {integrity: sha512-d}
+  /supports-color/8.1.1:
+    resolution: {integrity: sha512-e}
+`, map[string]map[string]string{
+			"":                     {"debug": "4.3.4", "foo": "npm:ms@2.0.0"},
+			"debug@4.3.4":          {"ms": "2.1.2", "supports-color": "7.2.0"},
+			"ms@2.0.0":             {},
+			"ms@2.1.2":             {},
+			"supports-color@7.2.0": {},
+			"supports-color@8.1.1": {},
+		}},
+		{"v6", `lockfileVersion: '6.0'
+dependencies:
+  debug:
+    specifier: ^4.3.0
+    version: 4.3.4(supports-color@8.1.1)
+  foo:
+    specifier: npm:ms@^2.0.0
+    version: /ms@2.0.0
+packages:
+  /debug@4.3.4(supports-color@8.1.1):
+    resolution: {integrity: sha512-a}
+    dependencies:
+      ms: 2.1.2
+      supports-color: 8.1.1
+  /ms@2.0.0:
+    resolution: {integrity: sha512-b}
+  /ms@2.1.2:
+    resolution: {integrity: sha512-c}
+  /supports-color@8.1.1:
+    resolution: {integrity: sha512-e}
+`, map[string]map[string]string{
+			"":                     {"debug": "4.3.4", "foo": "npm:ms@2.0.0"},
+			"debug@4.3.4":          {"ms": "2.1.2", "supports-color": "8.1.1"},
+			"ms@2.0.0":             {},
+			"ms@2.1.2":             {},
+			"supports-color@8.1.1": {},
+		}},
+		{"v9", `lockfileVersion: '9.0'
+importers:
+  .:
+    dependencies:
+      debug:
+        specifier: ^4.3.0
+        version: 4.3.4(supports-color@8.1.1)
+      foo:
+        specifier: npm:ms@^2.0.0
+        version: ms@2.0.0
+      lib:
+        specifier: workspace:*
+        version: link:packages/lib
+packages:
+  debug@4.3.4:
+    resolution: {integrity: sha512-a}
+  ms@2.0.0:
+    resolution: {integrity: sha512-b}
+  ms@2.1.2:
+    resolution: {integrity: sha512-c}
+  supports-color@7.2.0:
+    resolution: {integrity: sha512-d}
+  supports-color@8.1.1:
+    resolution: {integrity: sha512-e}
+snapshots:
+  debug@4.3.4(supports-color@7.2.0):
+    dependencies:
+      ms: 2.1.2
+      supports-color: 7.2.0
+  debug@4.3.4(supports-color@8.1.1):
+    dependencies:
+      ms: 2.1.2
+      supports-color: 8.1.1
+  ms@2.0.0: {}
+  ms@2.1.2: {}
+  supports-color@7.2.0: {}
+  supports-color@8.1.1: {}
+`, map[string]map[string]string{
+			"":                     {"debug": "4.3.4", "foo": "npm:ms@2.0.0"},
+			"debug@4.3.4":          {"ms": "2.1.2", "supports-color": "7.2.0"},
+			"ms@2.0.0":             {},
+			"ms@2.1.2":             {},
+			"supports-color@7.2.0": {},
+			"supports-color@8.1.1": {},
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			pl, err := ParsePnpmLock([]byte(tc.lock))
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+
+			// peer dependency variants must be combined the same way
+			// every time, regardless of map order
+			for i := 0; i < 10; i++ {
+				deps := pl.GetLockDependencies(nil)
+				if len(deps) != len(tc.expected) {
+					t.Fatalf("expected %d entries, got %d", len(tc.expected), len(deps))
+				}
+				for key, installed := range tc.expected {
+					d, ok := deps[key]
+					if !ok {
+						t.Fatalf("%q: expected entry", key)
+					}
+					if !reflect.DeepEqual(d.InstalledDependencies, installed) {
+						t.Fatalf("%q: expected installed %v, got %v", key, installed, d.InstalledDependencies)
+					}
+				}
+			}
+		})
+	}
+}
+
+const pnpmWorkspaceLock = `lockfileVersion: '9.0'
+importers:
+  .:
+    dependencies:
+      debug:
+        specifier: ^4.3.0
+        version: 4.3.4
+  packages/a:
+    dependencies:
+      b:
+        specifier: workspace:*
+        version: link:../b
+      ms:
+        specifier: ^2.1.3
+        version: 2.1.3
+  packages/b: {}
+  packages/c:
+packages:
+  debug@4.3.4:
+    resolution: {integrity: sha512-a}
+  ms@2.1.2:
+    resolution: {integrity: sha512-b}
+  ms@2.1.3:
+    resolution: {integrity: sha512-c}
+snapshots:
+  debug@4.3.4:
+    dependencies:
+      ms: 2.1.2
+  ms@2.1.2:
+  ms@2.1.3: {}
+`
+
+func TestPnpmLockGetLockDependenciesImporters(t *testing.T) {
+	pl, err := ParsePnpmLock([]byte(pnpmWorkspaceLock))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	workspaces := map[string]*PackageManifest{
+		"packages/a": {Name: "a", Version: "1.0.0"},
+		"packages/b": {Name: "b", Version: "1.0.0"},
+	}
+
+	deps := pl.GetLockDependencies(workspaces)
+	for _, tc := range []struct {
+		key       string
+		name      string
+		workspace bool
+		installed map[string]string
+	}{
+		{"", "", false, map[string]string{"debug": "4.3.4"}},
+		{"packages/a", "a", true, map[string]string{"ms": "2.1.3"}},
+		{"packages/b", "b", true, map[string]string{}},
+		{"packages/c", "", true, map[string]string{}},
+		{"debug@4.3.4", "debug", false, map[string]string{"ms": "2.1.2"}},
+		{"ms@2.1.2", "ms", false, map[string]string{}},
+		{"ms@2.1.3", "ms", false, map[string]string{}},
+	} {
+		d, ok := deps[tc.key]
+		if !ok {
+			t.Errorf("%q: expected entry", tc.key)
+			continue
+		}
+		if d.Name != tc.name || d.IsWorkspace != tc.workspace {
+			t.Errorf("%q: expected (%q, %v), got (%q, %v)", tc.key, tc.name, tc.workspace, d.Name, d.IsWorkspace)
+		}
+		if !reflect.DeepEqual(d.InstalledDependencies, tc.installed) {
+			t.Errorf("%q: expected installed %v, got %v", tc.key, tc.installed, d.InstalledDependencies)
+		}
+	}
+	if len(deps) != 7 {
+		t.Errorf("expected 7 entries, got %d", len(deps))
+	}
+}
@@ -0,0 +1,68 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright The Linux Foundation and npm-spdx contributors.
+
+package npm
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterBurstAndRate(t *testing.T) {
+	// 50 per second, so calls after the burst are 20ms apart
+	rl := newRateLimiter(50, 3)
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := rl.wait(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > 15*time.Millisecond {
+		t.Errorf("expected burst of 3 calls without waiting, took %v", elapsed)
+	}
+
+	for i := 0; i < 5; i++ {
+		if err := rl.wait(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Errorf("expected 5 more calls to take at least 100ms, took %v", elapsed)
+	}
+}
+
+func TestRateLimiterUnlimited(t *testing.T) {
+	rl := newRateLimiter(0, 5)
+	if rl != nil {
+		t.Fatalf("expected nil rateLimiter for rate 0")
+	}
+
+	start := time.Now()
+	for i := 0; i < 100; i++ {
+		if err := rl.wait(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Errorf("expected no waiting, took %v", elapsed)
+	}
+}
+
+func TestRateLimiterCancelled(t *testing.T) {
+	rl := newRateLimiter(1, 1)
+	if err := rl.wait(context.Background()); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := rl.wait(ctx); err != context.DeadlineExceeded {
+		t.Errorf("expected %v, got %v", context.DeadlineExceeded, err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("expected wait to stop when cancelled, took %v", elapsed)
+	}
+}
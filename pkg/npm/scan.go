@@ -0,0 +1,201 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright The Linux Foundation and npm-spdx contributors.
+
+package npm
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ScanNodeModules walks the installed node_modules directory
+// under rootDir, including nested and scoped package folders,
+// and reads each installed package's package.json file. It
+// compiles that information into a map of Dependency objects,
+// keyed by DependencyKey, in the same form that
+// GetAllDependencies returns; but without making any calls to
+// the NPM API. It also takes the root PackageManifest so that it
+// can note which dependencies are direct or direct dev.
+//
+// Symlinked package folders (such as workspace packages, or the
+// links into the store used by pnpm) are not followed, and
+// folders whose package.json file has no name or version are
+// skipped with a warning.
+func ScanNodeModules(rootDir string, manifest *PackageManifest) (map[string]*Dependency, error) {
+	// record the installed tree as if it were a lockfileVersion 3
+	// package-lock.json, so that dependencies get resolved the
+	// same way
+	lm := &PackageLockManifest{
+		Name:            manifest.Name,
+		Version:         manifest.Version,
+		LockfileVersion: 3,
+		Packages:        map[string]*PackageLockPackage{},
+	}
+	installed := map[string]*RegistryVersion{}
+
+	err := scanNodeModulesDir(rootDir, "", lm.Packages, installed)
+	if err != nil {
+		return nil, err
+	}
+
+	getVersion := func(name string, ver string) (*RegistryVersion, error) {
+		rver, ok := installed[DependencyKey(name, ver)]
+		if !ok {
+			return nil, fmt.Errorf("while scanning %s/%s: package.json not found", name, ver)
+		}
+		return rver, nil
+	}
+
+	allDeps, err := collectDependencies(lm.GetLockDependencies(nil), manifest, getVersion, 1, nil, false)
+	if err != nil {
+		return nil, err
+	}
+
+	// read the text of licenses declared as being in a file, from
+	// the first copy of each package version found
+	for _, path := range getSortedPackagePaths(lm.Packages) {
+		pkg := lm.Packages[path]
+		d := allDeps[DependencyKey(pkg.Name, pkg.Version)]
+		if d == nil || d.LicenseFile == "" || d.LicenseText != "" {
+			continue
+		}
+		text, err := readLicenseFile(filepath.Join(rootDir, filepath.FromSlash(path)), d.LicenseFile)
+		if err != nil {
+			fmt.Printf("Warning: couldn't read %s for %s/%s: %v\n", d.LicenseFile, d.Name, d.Version, err)
+			continue
+		}
+		d.LicenseText = text
+	}
+
+	return allDeps, nil
+}
+
+// getSortedPackagePaths returns the keys of packages in sorted
+// order.
+func getSortedPackagePaths(packages map[string]*PackageLockPackage) []string {
+	paths := []string{}
+	for path := range packages {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// readLicenseFile returns the text of the license file at
+// filename, relative to the package directory pkgDir.
+func readLicenseFile(pkgDir string, filename string) (string, error) {
+	clean := path.Clean(strings.TrimPrefix(filename, "./"))
+	if clean == ".." || strings.HasPrefix(clean, "../") || path.IsAbs(clean) {
+		return "", fmt.Errorf("%s is outside the package", filename)
+	}
+
+	f, err := os.Open(filepath.Join(pkgDir, filepath.FromSlash(clean)))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	text, err := ioutil.ReadAll(io.LimitReader(f, maxLicenseFileSize))
+	if err != nil {
+		return "", err
+	}
+	return string(text), nil
+}
+
+// scanNodeModulesDir reads the packages installed in the
+// node_modules directory of the package at parentPath (relative
+// to rootDir, with "" for the root package), adding them to
+// packages and installed, and then recurses into each one's own
+// node_modules directory.
+func scanNodeModulesDir(rootDir string, parentPath string, packages map[string]*PackageLockPackage, installed map[string]*RegistryVersion) error {
+	nmPath := "node_modules"
+	if parentPath != "" {
+		nmPath = parentPath + "/node_modules"
+	}
+
+	entries, err := ioutil.ReadDir(filepath.Join(rootDir, filepath.FromSlash(nmPath)))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error reading %s: %v", nmPath, err)
+	}
+
+	for _, e := range entries {
+		name := e.Name()
+		// skip .bin, .package-lock.json, .pnpm and the like
+		if strings.HasPrefix(name, ".") || !e.IsDir() {
+			continue
+		}
+
+		if strings.HasPrefix(name, "@") {
+			// scope folder, containing the actual package folders
+			scopeDir := filepath.Join(rootDir, filepath.FromSlash(nmPath), name)
+			scoped, err := ioutil.ReadDir(scopeDir)
+			if err != nil {
+				return fmt.Errorf("error reading %s/%s: %v", nmPath, name, err)
+			}
+			for _, se := range scoped {
+				if !se.IsDir() {
+					continue
+				}
+				err = scanPackageDir(rootDir, nmPath+"/"+name+"/"+se.Name(), packages, installed)
+				if err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		err = scanPackageDir(rootDir, nmPath+"/"+name, packages, installed)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// scanPackageDir reads the package.json file for the package
+// installed at path (relative to rootDir), if any, and then scans
+// its own node_modules directory.
+func scanPackageDir(rootDir string, path string, packages map[string]*PackageLockPackage, installed map[string]*RegistryVersion) error {
+	pjsFilename := filepath.Join(rootDir, filepath.FromSlash(path), "package.json")
+	js, err := ioutil.ReadFile(pjsFilename)
+	if os.IsNotExist(err) {
+		// not actually a package
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error reading %s: %v", pjsFilename, err)
+	}
+
+	rver := &RegistryVersion{}
+	err = json.Unmarshal(js, rver)
+	if err != nil {
+		return fmt.Errorf("error parsing %s: %v", pjsFilename, err)
+	}
+	if rver.Name == "" || rver.Version == "" {
+		// e.g. a test fixture or other directory that happens to
+		// contain a package.json file, rather than an installed
+		// package
+		fmt.Printf("Warning: skipping %s: package.json has no name or version\n", path)
+		return nil
+	}
+
+	packages[path] = &PackageLockPackage{
+		Name:         rver.Name,
+		Version:      rver.Version,
+		Dependencies: rver.Dependencies,
+	}
+	installed[DependencyKey(rver.Name, rver.Version)] = rver
+
+	return scanNodeModulesDir(rootDir, path, packages, installed)
+}
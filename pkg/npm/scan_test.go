@@ -0,0 +1,93 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright The Linux Foundation and npm-spdx contributors.
+
+package npm
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeTree creates the files, keyed by slash-separated path,
+// under a new temporary directory and returns its name.
+func writeTree(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "npm-spdx-test-")
+	if err != nil {
+		t.Fatalf("error creating temporary directory: %v", err)
+	}
+	for name, content := range files {
+		filename := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+			t.Fatalf("error creating directory: %v", err)
+		}
+		if err := ioutil.WriteFile(filename, []byte(content), 0644); err != nil {
+			t.Fatalf("error writing %s: %v", name, err)
+		}
+	}
+	return dir
+}
+
+func TestScanNodeModules(t *testing.T) {
+	dir := writeTree(t, map[string]string{
+		"node_modules/a/package.json":                `{"name": "a", "version": "1.0.0", "license": "MIT", "dependencies": {"b": "^1.0.0"}}`,
+		"node_modules/a/node_modules/b/package.json": `{"name": "b", "version": "1.1.0", "license": "ISC"}`,
+		"node_modules/b/package.json":                `{"name": "b", "version": "1.0.0", "license": "ISC"}`,
+		"node_modules/@s/c/package.json":             `{"name": "@s/c", "version": "2.0.0", "license": "SEE LICENSE IN LICENSE"}`,
+		"node_modules/@s/c/LICENSE":                  "license text",
+		"node_modules/d/package.json":                `{"name": "e", "version": "3.0.0", "license": "MIT"}`,
+		// no name or version, e.g. a test fixture
+		"node_modules/fixture/package.json":     `{"private": true}`,
+		"node_modules/nameless/package.json":    `{"version": "1.0.0"}`,
+		"node_modules/versionless/package.json": `{"name": "versionless"}`,
+		"node_modules/.bin/a":                   "",
+		"node_modules/notapackage/README":       "",
+	})
+	defer os.RemoveAll(dir)
+
+	manifest := &PackageManifest{
+		Name:            "app",
+		Version:         "1.0.0",
+		Dependencies:    map[string]string{"a": "^1.0.0", "@s/c": "^2.0.0", "d": "npm:e@^3.0.0"},
+		DevDependencies: map[string]string{"b": "^1.0.0", "fixture": "^1.0.0"},
+	}
+	allDeps, err := ScanNodeModules(dir, manifest)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	for _, tc := range []struct {
+		key       string
+		license   string
+		direct    bool
+		directDev bool
+		installed map[string]string
+		text      string
+	}{
+		{"a@1.0.0", "MIT", true, false, map[string]string{"b": "1.1.0"}, ""},
+		{"b@1.1.0", "ISC", false, false, map[string]string{}, ""},
+		{"b@1.0.0", "ISC", false, true, map[string]string{}, ""},
+		{"@s/c@2.0.0", "SEE LICENSE IN LICENSE", true, false, map[string]string{}, "license text"},
+		{"e@3.0.0", "MIT", true, false, map[string]string{}, ""},
+	} {
+		d, ok := allDeps[tc.key]
+		if !ok {
+			t.Errorf("%s: expected to be found", tc.key)
+			continue
+		}
+		if d.License != tc.license || d.LicenseText != tc.text {
+			t.Errorf("%s: expected license (%q, %q), got (%q, %q)", tc.key, tc.license, tc.text, d.License, d.LicenseText)
+		}
+		if d.IsDirectDep != tc.direct || d.IsDirectDevDep != tc.directDev {
+			t.Errorf("%s: expected direct (%v, %v), got (%v, %v)", tc.key, tc.direct, tc.directDev, d.IsDirectDep, d.IsDirectDevDep)
+		}
+		if !reflect.DeepEqual(d.InstalledDependencies, tc.installed) {
+			t.Errorf("%s: expected installed %v, got %v", tc.key, tc.installed, d.InstalledDependencies)
+		}
+	}
+	if len(allDeps) != 5 {
+		t.Errorf("expected 5 dependencies, got %d", len(allDeps))
+	}
+}
@@ -0,0 +1,272 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright The Linux Foundation and npm-spdx contributors.
+
+package npm
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Snapshot contains previously-retrieved registry data for a set
+// of package versions, so that dependencies can be retrieved
+// without access to the registry. A snapshot is stored either as
+// a directory of files in the same format as the Cache (so the
+// cache directory can itself be used as a snapshot), or as a
+// gzipped tar archive of such files, as written by ExportSnapshot.
+type Snapshot struct {
+	// entries maps each DependencyKey to its data.
+	entries map[string]*cacheEntry
+}
+
+// SnapshotMissingError is returned by GetOfflineDependencies when
+// the Snapshot doesn't contain data for some of the package
+// versions that are needed.
+type SnapshotMissingError struct {
+	// Missing lists the DependencyKey of each missing package
+	// version, in sorted order.
+	Missing []string
+}
+
+func (e *SnapshotMissingError) Error() string {
+	return fmt.Sprintf("%d package versions missing from snapshot:\n\t%s", len(e.Missing), strings.Join(e.Missing, "\n\t"))
+}
+
+// LoadSnapshot reads the Snapshot at path, which may be either a
+// directory or an archive file.
+func LoadSnapshot(path string) (*Snapshot, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading snapshot: %v", err)
+	}
+	if fi.IsDir() {
+		return loadSnapshotDir(path)
+	}
+	return loadSnapshotArchive(path)
+}
+
+// getSnapshotKey returns the DependencyKey for a snapshot file's
+// name, or false if it isn't a snapshot entry (such as a
+// temporary file left behind in the cache directory).
+func getSnapshotKey(filename string) (string, bool) {
+	if strings.HasPrefix(filename, ".") || !strings.HasSuffix(filename, ".json") {
+		return "", false
+	}
+	key, err := url.PathUnescape(strings.TrimSuffix(filename, ".json"))
+	if err != nil {
+		return "", false
+	}
+	return key, true
+}
+
+// addEntry parses a snapshot file's contents and adds it to the
+// Snapshot. As with the Cache, entries in an older format are
+// ignored, so that they are reported as missing rather than used
+// without the fields they lack.
+func (s *Snapshot) addEntry(filename string, js []byte) error {
+	key, ok := getSnapshotKey(filename)
+	if !ok {
+		return nil
+	}
+
+	e := &cacheEntry{}
+	err := json.Unmarshal(js, e)
+	if err != nil {
+		return fmt.Errorf("error parsing snapshot entry %s: %v", filename, err)
+	}
+	if e.Format != cacheFormat {
+		return nil
+	}
+	s.entries[key] = e
+	return nil
+}
+
+// loadSnapshotDir reads a Snapshot from a directory.
+func loadSnapshotDir(dir string) (*Snapshot, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("error reading snapshot directory %s: %v", dir, err)
+	}
+
+	s := &Snapshot{entries: map[string]*cacheEntry{}}
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+		if _, ok := getSnapshotKey(f.Name()); !ok {
+			continue
+		}
+		filename := filepath.Join(dir, f.Name())
+		js, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s: %v", filename, err)
+		}
+		err = s.addEntry(f.Name(), js)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+// loadSnapshotArchive reads a Snapshot from a gzipped tar archive.
+func loadSnapshotArchive(filename string) (*Snapshot, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("error reading snapshot: %v", err)
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("error reading snapshot archive %s: %v", filename, err)
+	}
+	defer gz.Close()
+
+	s := &Snapshot{entries: map[string]*cacheEntry{}}
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading snapshot archive %s: %v", filename, err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		js, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s from snapshot archive %s: %v", hdr.Name, filename, err)
+		}
+		err = s.addEntry(path.Base(hdr.Name), js)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+// Missing returns the sorted DependencyKeys of the package
+// versions in deps (as returned by ParseLockDependencies) that
+// the Snapshot doesn't contain.
+func (s *Snapshot) Missing(deps map[string]*PackageLockDependency) []string {
+	keys, _ := getDistinctVersions(deps, getRetrievedPaths(deps))
+
+	missing := []string{}
+	for _, key := range keys {
+		if _, ok := s.entries[key]; !ok {
+			missing = append(missing, key)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// GetVersionData returns the RegistryVersion data for the
+// specified package and version from the Snapshot, so that a
+// Snapshot can be used as a Registry.
+func (s *Snapshot) GetVersionData(ctx context.Context, name string, ver string) (*RegistryVersion, error) {
+	e, ok := s.entries[DependencyKey(name, ver)]
+	if !ok {
+		return nil, &SnapshotMissingError{Missing: []string{DependencyKey(name, ver)}}
+	}
+	return e.getRegistryVersion(name, ver)
+}
+
+// GetOfflineDependencies does the same as GetAllDependencies, but
+// takes the RegistryVersion data from the Snapshot instead of
+// querying the NPM API. If the Snapshot is missing any of the
+// package versions that are needed, it returns a
+// SnapshotMissingError listing all of them.
+//
+// Snapshots don't contain package tarballs, so unlike
+// GetAllDependencies, it doesn't fill in the LicenseText of
+// licenses declared as "SEE LICENSE IN <file>".
+func GetOfflineDependencies(s *Snapshot, deps map[string]*PackageLockDependency, manifest *PackageManifest) (map[string]*Dependency, error) {
+	if missing := s.Missing(deps); len(missing) > 0 {
+		return nil, &SnapshotMissingError{Missing: missing}
+	}
+
+	getVersion := func(name string, ver string) (*RegistryVersion, error) {
+		return s.GetVersionData(context.Background(), name, ver)
+	}
+	return collectDependencies(deps, manifest, getVersion, 1, nil, false)
+}
+
+// ExportSnapshot retrieves the RegistryVersion data for each
+// package version in deps (as returned by ParseLockDependencies),
+// from the Registry in the same way as GetAllDependencies, and
+// saves it to filename as a gzipped tar archive that can be read
+// by LoadSnapshot.
+func ExportSnapshot(ctx context.Context, reg Registry, deps map[string]*PackageLockDependency, opts *RetrieveOptions, filename string) error {
+	if opts == nil {
+		opts = DefaultRetrieveOptions()
+	}
+
+	keys, toGet := getDistinctVersions(deps, getRetrievedPaths(deps))
+
+	getVersion := newLimitedVersionGetter(ctx, reg, newRateLimiter(opts.RequestsPerSecond, opts.Burst))
+	rvers, errs := getAllVersions(keys, toGet, getVersion, opts.Concurrency, false)
+	if err := firstError(errs); err != nil {
+		return err
+	}
+
+	// write the archive atomically, so that a failure doesn't
+	// leave a truncated one behind
+	return writeFileAtomicFunc(filename, func(w io.Writer) error {
+		return writeSnapshotArchive(w, keys, rvers)
+	})
+}
+
+// writeSnapshotArchive writes a gzipped tar archive to w, with one
+// entry for each of the keys and corresponding RegistryVersions.
+func writeSnapshotArchive(w io.Writer, keys []string, rvers []*RegistryVersion) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	now := time.Now().UTC()
+	for i, key := range keys {
+		js, err := marshalCacheEntry("", "", now, 0, rvers[i])
+		if err != nil {
+			return err
+		}
+
+		hdr := &tar.Header{
+			Name:    url.PathEscape(key) + ".json",
+			Mode:    0644,
+			Size:    int64(len(js)),
+			ModTime: now,
+		}
+		err = tw.WriteHeader(hdr)
+		if err != nil {
+			return err
+		}
+		_, err = tw.Write(js)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := tw.Close()
+	if err != nil {
+		return err
+	}
+	return gz.Close()
+}
@@ -0,0 +1,116 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright The Linux Foundation and npm-spdx contributors.
+
+package npm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// snapshotRegistry is a Registry that serves versions from a map,
+// and fails for any others.
+type snapshotRegistry map[string]*RegistryVersion
+
+func (r snapshotRegistry) GetVersionData(ctx context.Context, pkg string, ver string) (*RegistryVersion, error) {
+	if rver, ok := r[DependencyKey(pkg, ver)]; ok {
+		return rver, nil
+	}
+	return nil, fmt.Errorf("%s/%s %w", pkg, ver, ErrNotFound)
+}
+
+func TestSnapshotAddEntry(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		filename string
+		js       string
+		key      string
+		err      bool
+	}{
+		{"current format", "a@1.0.0.json", fmt.Sprintf(`{"format": %d, "fetched": "2019-01-01T00:00:00Z", "data": {}}`, cacheFormat), "a@1.0.0", false},
+		{"scoped", "@s%2Fb@1.0.0.json", fmt.Sprintf(`{"format": %d, "fetched": "2019-01-01T00:00:00Z", "data": {}}`, cacheFormat), "@s/b@1.0.0", false},
+		{"older format", "a@1.0.0.json", fmt.Sprintf(`{"format": %d, "fetched": "2019-01-01T00:00:00Z", "data": {}}`, cacheFormat-1), "", false},
+		{"temporary file", ".tmp-123", `{`, "", false},
+		{"invalid JSON", "a@1.0.0.json", `{`, "", true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := &Snapshot{entries: map[string]*cacheEntry{}}
+			err := s.addEntry(tc.filename, []byte(tc.js))
+			if (err != nil) != tc.err {
+				t.Fatalf("expected error %v, got %v", tc.err, err)
+			}
+			keys := []string{}
+			for key := range s.entries {
+				keys = append(keys, key)
+			}
+			expected := []string{}
+			if tc.key != "" {
+				expected = append(expected, tc.key)
+			}
+			if !reflect.DeepEqual(keys, expected) {
+				t.Errorf("expected entries %v, got %v", expected, keys)
+			}
+		})
+	}
+}
+
+func TestExportSnapshot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "npm-spdx-test-")
+	if err != nil {
+		t.Fatalf("error creating temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	deps := map[string]*PackageLockDependency{
+		"":                  {InstalledDependencies: map[string]string{"a": "1.0.0", "@s/b": "2.0.0"}},
+		"node_modules/a":    {Name: "a", Version: "1.0.0"},
+		"node_modules/@s/b": {Name: "@s/b", Version: "2.0.0"},
+	}
+	reg := snapshotRegistry{
+		"a@1.0.0":    {Name: "a", Version: "1.0.0", License: "MIT"},
+		"@s/b@2.0.0": {Name: "@s/b", Version: "2.0.0", License: "ISC"},
+	}
+	filename := filepath.Join(dir, "snapshot.tar.gz")
+
+	// a failure leaves no archive behind
+	delete(reg, "@s/b@2.0.0")
+	err = ExportSnapshot(context.Background(), reg, deps, nil, filename)
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 0 {
+		t.Fatalf("expected no files after failure, got %d", len(files))
+	}
+
+	reg["@s/b@2.0.0"] = &RegistryVersion{Name: "@s/b", Version: "2.0.0", License: "ISC"}
+	err = ExportSnapshot(context.Background(), reg, deps, nil, filename)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	s, err := LoadSnapshot(filename)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	manifest := &PackageManifest{Name: "app", Version: "1.0.0", Dependencies: map[string]string{"a": "^1.0.0"}}
+	allDeps, err := GetOfflineDependencies(s, deps, manifest)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(allDeps) != 2 || allDeps["a@1.0.0"].License != "MIT" || !allDeps["a@1.0.0"].IsDirectDep || allDeps["@s/b@2.0.0"].License != "ISC" {
+		t.Errorf("expected a@1.0.0 and @s/b@2.0.0 from snapshot, got %v", allDeps)
+	}
+
+	deps["node_modules/c"] = &PackageLockDependency{Name: "c", Version: "3.0.0"}
+	_, err = GetOfflineDependencies(s, deps, manifest)
+	var merr *SnapshotMissingError
+	if !errors.As(err, &merr) || !reflect.DeepEqual(merr.Missing, []string{"c@3.0.0"}) {
+		t.Errorf("expected c@3.0.0 to be missing, got %v", err)
+	}
+}
@@ -0,0 +1,152 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright The Linux Foundation and npm-spdx contributors.
+
+package npm
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// TransferStats counts the requests made to the registry and the
+// data transferred, so that the effect of the cache and of
+// requesting only the versions needed can be seen. Its methods
+// may be called concurrently, and do nothing on a nil
+// TransferStats.
+type TransferStats struct {
+	requests   int64
+	downloaded int64
+	saved      int64
+
+	// scoped packages retrieved from the per-version endpoint,
+	// and from the full package document instead
+	scopedVersions     int64
+	scopedVersionBytes int64
+	packuments         int64
+	packumentBytes     int64
+}
+
+// Requests returns the number of requests sent to the registry,
+// including retries.
+func (ts *TransferStats) Requests() int64 {
+	if ts == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&ts.requests)
+}
+
+// BytesDownloaded returns the total size of the response bodies
+// received from the registry.
+func (ts *TransferStats) BytesDownloaded() int64 {
+	if ts == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&ts.downloaded)
+}
+
+// BytesSaved returns the total size of the responses that didn't
+// need to be downloaded, because the data was taken from the
+// cache or confirmed as unchanged by the registry.
+func (ts *TransferStats) BytesSaved() int64 {
+	if ts == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&ts.saved)
+}
+
+// ScopedVersions returns the number of scoped package versions
+// downloaded from the registry's per-version endpoint, and the
+// total size of those responses.
+func (ts *TransferStats) ScopedVersions() (int64, int64) {
+	if ts == nil {
+		return 0, 0
+	}
+	return atomic.LoadInt64(&ts.scopedVersions), atomic.LoadInt64(&ts.scopedVersionBytes)
+}
+
+// Packuments returns the number of full package documents, with
+// every version of a scoped package, downloaded because the
+// registry didn't support the per-version endpoint; and the total
+// size of those responses.
+func (ts *TransferStats) Packuments() (int64, int64) {
+	if ts == nil {
+		return 0, 0
+	}
+	return atomic.LoadInt64(&ts.packuments), atomic.LoadInt64(&ts.packumentBytes)
+}
+
+// EstimatedScopedBytesSaved returns an estimate of the bytes saved
+// by downloading scoped package versions from the per-version
+// endpoint rather than the full package documents. Since the full
+// documents for those packages aren't downloaded, their sizes are
+// estimated as the average size of the full documents that were
+// downloaded. It returns false if no full documents were
+// downloaded, in which case the saving can't be estimated.
+func (ts *TransferStats) EstimatedScopedBytesSaved() (int64, bool) {
+	versions, versionBytes := ts.ScopedVersions()
+	packuments, packumentBytes := ts.Packuments()
+	if packuments == 0 {
+		return 0, false
+	}
+	saved := versions*packumentBytes/packuments - versionBytes
+	if saved < 0 {
+		saved = 0
+	}
+	return saved, true
+}
+
+// String summarizes the TransferStats.
+func (ts *TransferStats) String() string {
+	s := fmt.Sprintf("%d registry requests, %d bytes downloaded, %d bytes saved by cached data", ts.Requests(), ts.BytesDownloaded(), ts.BytesSaved())
+	versions, versionBytes := ts.ScopedVersions()
+	packuments, packumentBytes := ts.Packuments()
+	if versions > 0 || packuments > 0 {
+		s += fmt.Sprintf("; of which %d bytes for %d scoped package versions from the per-version endpoint, and %d bytes for %d full package documents", versionBytes, versions, packumentBytes, packuments)
+	}
+	if versions > 0 {
+		if saved, ok := ts.EstimatedScopedBytesSaved(); ok {
+			s += fmt.Sprintf("; an estimated %d bytes saved by the per-version endpoint, based on the average full document size", saved)
+		} else {
+			s += "; bytes saved by the per-version endpoint not measured, since no full documents were downloaded"
+		}
+	}
+	return s
+}
+
+// addDownload records a request whose response body was n bytes.
+func (ts *TransferStats) addDownload(n int) {
+	if ts == nil {
+		return
+	}
+	atomic.AddInt64(&ts.requests, 1)
+	atomic.AddInt64(&ts.downloaded, int64(n))
+}
+
+// addSaved records that a response of n bytes didn't need to be
+// downloaded.
+func (ts *TransferStats) addSaved(n int64) {
+	if ts == nil {
+		return
+	}
+	atomic.AddInt64(&ts.saved, n)
+}
+
+// addScopedVersion records that a scoped package version was
+// downloaded from the per-version endpoint, in n bytes.
+func (ts *TransferStats) addScopedVersion(n int) {
+	if ts == nil {
+		return
+	}
+	atomic.AddInt64(&ts.scopedVersions, 1)
+	atomic.AddInt64(&ts.scopedVersionBytes, int64(n))
+}
+
+// addPackument records that a full package document of n bytes
+// was downloaded for a scoped package.
+func (ts *TransferStats) addPackument(n int) {
+	if ts == nil {
+		return
+	}
+	atomic.AddInt64(&ts.packuments, 1)
+	atomic.AddInt64(&ts.packumentBytes, int64(n))
+}
@@ -0,0 +1,52 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright The Linux Foundation and npm-spdx contributors.
+
+package npm
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEstimatedScopedBytesSaved(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		versions   []int
+		packuments []int
+		saved      int64
+		ok         bool
+		summary    string
+	}{
+		{"nothing scoped", nil, nil, 0, false, ""},
+		{"no full documents", []int{100, 200}, nil, 0, false, "not measured"},
+		{"average full document", []int{100, 200}, []int{1000, 3000}, 3700, true, "an estimated 3700 bytes saved"},
+		{"only full documents", nil, []int{1000}, 0, true, ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ts := &TransferStats{}
+			for _, n := range tc.versions {
+				ts.addScopedVersion(n)
+			}
+			for _, n := range tc.packuments {
+				ts.addPackument(n)
+			}
+
+			saved, ok := ts.EstimatedScopedBytesSaved()
+			if saved != tc.saved || ok != tc.ok {
+				t.Errorf("expected (%d, %v), got (%d, %v)", tc.saved, tc.ok, saved, ok)
+			}
+			s := ts.String()
+			if tc.summary != "" && !strings.Contains(s, tc.summary) {
+				t.Errorf("expected summary to contain %q, got %q", tc.summary, s)
+			}
+			if tc.summary == "" && strings.Contains(s, "saved by the per-version endpoint") {
+				t.Errorf("expected no saving in summary, got %q", s)
+			}
+		})
+	}
+
+	var ts *TransferStats
+	if _, ok := ts.EstimatedScopedBytesSaved(); ok {
+		t.Errorf("expected no estimate for nil TransferStats")
+	}
+}
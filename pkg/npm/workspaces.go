@@ -0,0 +1,228 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright The Linux Foundation and npm-spdx contributors.
+
+package npm
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// GetWorkspacePatterns returns the glob patterns listed in the
+// PackageManifest's "workspaces" field, which may be either an
+// array of patterns or an object with a "packages" array (as
+// used by Yarn).
+func (pm *PackageManifest) GetWorkspacePatterns() []string {
+	var list []interface{}
+	switch w := pm.Workspaces.(type) {
+	case []interface{}:
+		list = w
+	case map[string]interface{}:
+		if pkgs, ok := w["packages"].([]interface{}); ok {
+			list = pkgs
+		}
+	}
+
+	patterns := []string{}
+	for _, v := range list {
+		if p, ok := v.(string); ok {
+			patterns = append(patterns, p)
+		}
+	}
+	return patterns
+}
+
+// pnpmWorkspaceFile represents the data from a pnpm-workspace.yaml
+// file, which pnpm uses to list workspace packages instead of the
+// package.json "workspaces" field.
+type pnpmWorkspaceFile struct {
+	Packages []string `yaml:"packages"`
+}
+
+// getPnpmWorkspacePatterns returns the glob patterns listed in the
+// pnpm-workspace.yaml file in rootDir, or nil if there isn't one.
+func getPnpmWorkspacePatterns(rootDir string) ([]string, error) {
+	filename := filepath.Join(rootDir, "pnpm-workspace.yaml")
+	b, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %v", filename, err)
+	}
+
+	pw := &pnpmWorkspaceFile{}
+	err = yaml.Unmarshal(b, pw)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing %s: %v", filename, err)
+	}
+	return pw.Packages, nil
+}
+
+// LoadWorkspaceManifests finds the workspace packages belonging
+// to the root PackageManifest, which was read from rootDir, and
+// reads and parses each one's package.json file. Workspaces are
+// listed in the PackageManifest's "workspaces" field, or for pnpm
+// in a pnpm-workspace.yaml file in rootDir. It returns a map of
+// their paths relative to rootDir (using forward slashes, as in
+// lockfiles) to their PackageManifests. Patterns beginning with
+// "!" exclude matching directories, and "**" matches any number
+// of nested directories.
+func LoadWorkspaceManifests(rootDir string, manifest *PackageManifest) (map[string]*PackageManifest, error) {
+	pnpmPatterns, err := getPnpmWorkspacePatterns(rootDir)
+	if err != nil {
+		return nil, err
+	}
+
+	included := map[string]bool{}
+	excluded := map[string]bool{}
+	for _, pattern := range append(manifest.GetWorkspacePatterns(), pnpmPatterns...) {
+		target := included
+		if strings.HasPrefix(pattern, "!") {
+			target = excluded
+			pattern = strings.TrimPrefix(pattern, "!")
+		}
+
+		matches, err := globWorkspaces(rootDir, pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid workspaces pattern %q: %v", pattern, err)
+		}
+		for _, m := range matches {
+			rel, err := filepath.Rel(rootDir, m)
+			if err != nil {
+				return nil, fmt.Errorf("error getting relative path for %s: %v", m, err)
+			}
+			target[filepath.ToSlash(rel)] = true
+		}
+	}
+
+	workspaces := map[string]*PackageManifest{}
+	for path := range included {
+		if excluded[path] {
+			continue
+		}
+
+		// only directories containing a package.json are workspaces
+		pjsFilename := filepath.Join(rootDir, filepath.FromSlash(path), "package.json")
+		js, err := ioutil.ReadFile(pjsFilename)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s: %v", pjsFilename, err)
+		}
+
+		wm, err := ParseManifest(js)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing %s: %v", pjsFilename, err)
+		}
+		workspaces[path] = wm
+	}
+
+	return workspaces, nil
+}
+
+// globWorkspaces returns the paths within rootDir that match the
+// workspaces pattern. Patterns without "**" are matched with
+// filepath.Glob; otherwise rootDir is walked to find matching
+// directories, skipping node_modules and hidden directories.
+func globWorkspaces(rootDir string, pattern string) ([]string, error) {
+	if !strings.Contains(pattern, "**") {
+		return filepath.Glob(filepath.Join(rootDir, filepath.FromSlash(pattern)))
+	}
+
+	patternSegs := strings.Split(path.Clean(pattern), "/")
+	// check the pattern's syntax up front, as filepath.Glob does
+	for _, seg := range patternSegs {
+		if _, err := path.Match(seg, ""); err != nil {
+			return nil, err
+		}
+	}
+
+	matches := []string{}
+	err := filepath.Walk(rootDir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() || p == rootDir {
+			return nil
+		}
+		if info.Name() == "node_modules" || strings.HasPrefix(info.Name(), ".") {
+			return filepath.SkipDir
+		}
+		rel, err := filepath.Rel(rootDir, p)
+		if err != nil {
+			return err
+		}
+		if matchPathSegments(patternSegs, strings.Split(filepath.ToSlash(rel), "/")) {
+			matches = append(matches, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return matches, nil
+}
+
+// matchPathSegments returns whether the path segments match the
+// pattern segments, where a "**" segment matches zero or more
+// path segments and other segments are matched with path.Match.
+func matchPathSegments(patternSegs []string, pathSegs []string) bool {
+	if len(patternSegs) == 0 {
+		return len(pathSegs) == 0
+	}
+	if patternSegs[0] == "**" {
+		for i := 0; i <= len(pathSegs); i++ {
+			if matchPathSegments(patternSegs[1:], pathSegs[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(pathSegs) == 0 {
+		return false
+	}
+	if ok, _ := path.Match(patternSegs[0], pathSegs[0]); !ok {
+		return false
+	}
+	return matchPathSegments(patternSegs[1:], pathSegs[1:])
+}
+
+// BuildWorkspaces takes the workspace PackageManifests returned by
+// LoadWorkspaceManifests and the corresponding entries returned by
+// ParseLockDependencies, and returns a Workspace object for each
+// one, sorted by path.
+func BuildWorkspaces(workspaces map[string]*PackageManifest, deps map[string]*PackageLockDependency) []*Workspace {
+	paths := []string{}
+	for path := range workspaces {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	wss := []*Workspace{}
+	for _, path := range paths {
+		wm := workspaces[path]
+		ws := &Workspace{
+			Name:            wm.Name,
+			Version:         wm.Version,
+			License:         wm.License,
+			Path:            path,
+			Dependencies:    wm.Dependencies,
+			DevDependencies: wm.DevDependencies,
+		}
+		if d, ok := deps[path]; ok {
+			ws.InstalledDependencies = d.InstalledDependencies
+		}
+		wss = append(wss, ws)
+	}
+
+	return wss
+}
@@ -0,0 +1,153 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright The Linux Foundation and npm-spdx contributors.
+
+package npm
+
+import (
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// getWorkspacePaths returns the sorted paths of the workspaces.
+func getWorkspacePaths(workspaces map[string]*PackageManifest) []string {
+	paths := []string{}
+	for path := range workspaces {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func TestGetWorkspacePatterns(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		js       string
+		expected []string
+	}{
+		{"none", `{}`, []string{}},
+		{"array", `{"workspaces": ["packages/*", "!packages/skip"]}`, []string{"packages/*", "!packages/skip"}},
+		{"object", `{"workspaces": {"packages": ["packages/*"], "nohoist": ["**/foo"]}}`, []string{"packages/*"}},
+		{"object without packages", `{"workspaces": {"nohoist": ["**/foo"]}}`, []string{}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			pm, err := ParseManifest([]byte(tc.js))
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if got := pm.GetWorkspacePatterns(); !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestMatchPathSegments(t *testing.T) {
+	for _, tc := range []struct {
+		pattern string
+		path    string
+		match   bool
+	}{
+		{"packages/*", "packages/a", true},
+		{"packages/*", "packages/a/b", false},
+		{"packages/**", "packages", true},
+		{"packages/**", "packages/a/b", true},
+		{"**/lib", "lib", true},
+		{"**/lib", "packages/a/lib", true},
+		{"**/lib", "packages/a/lib/x", false},
+		{"packages/**/ui-*", "packages/web/ui-core", true},
+		{"packages/**/ui-*", "packages/web/core", false},
+	} {
+		got := matchPathSegments(strings.Split(tc.pattern, "/"), strings.Split(tc.path, "/"))
+		if got != tc.match {
+			t.Errorf("%q %q: expected %v, got %v", tc.pattern, tc.path, tc.match, got)
+		}
+	}
+}
+
+func TestLoadWorkspaceManifests(t *testing.T) {
+	dir := writeTree(t, map[string]string{
+		"packages/a/package.json":                     `{"name": "a", "version": "1.0.0"}`,
+		"packages/skip/package.json":                  `{"name": "skip", "version": "1.0.0"}`,
+		"packages/notapackage/README.md":              "not a workspace",
+		"tools/build/cli/package.json":                `{"name": "cli", "version": "2.0.0"}`,
+		"tools/build/cli/node_modules/x/package.json": `{"name": "x", "version": "1.0.0"}`,
+		"tools/lint/package.json":                     `{"name": "lint", "version": "3.0.0"}`,
+	})
+	defer os.RemoveAll(dir)
+
+	for _, tc := range []struct {
+		name     string
+		js       string
+		expected []string
+	}{
+		{"array", `{"workspaces": ["packages/*", "!packages/skip"]}`, []string{"packages/a"}},
+		{"object", `{"workspaces": {"packages": ["packages/*"]}}`, []string{"packages/a", "packages/skip"}},
+		{"globstar", `{"workspaces": ["./tools/**"]}`, []string{"tools/build/cli", "tools/lint"}},
+		{"none", `{}`, []string{}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			pm, err := ParseManifest([]byte(tc.js))
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			workspaces, err := LoadWorkspaceManifests(dir, pm)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if paths := getWorkspacePaths(workspaces); !reflect.DeepEqual(paths, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, paths)
+			}
+		})
+	}
+
+	_, err := LoadWorkspaceManifests(dir, &PackageManifest{Workspaces: []interface{}{"packages/["}})
+	if err == nil {
+		t.Errorf("expected error for invalid pattern, got nil")
+	}
+}
+
+func TestBuildWorkspaces(t *testing.T) {
+	workspaces := map[string]*PackageManifest{
+		"packages/b": {Name: "b", Version: "2.0.0", License: "MIT", Dependencies: map[string]string{"ms": "^2.1.0"}},
+		"packages/a": {Name: "a", Version: "1.0.0", DevDependencies: map[string]string{"b": "*"}},
+	}
+	deps := map[string]*PackageLockDependency{
+		"packages/b": {InstalledDependencies: map[string]string{"ms": "2.1.3"}},
+	}
+
+	wss := BuildWorkspaces(workspaces, deps)
+	if len(wss) != 2 {
+		t.Fatalf("expected 2 workspaces, got %d", len(wss))
+	}
+	if wss[0].Path != "packages/a" || wss[0].Name != "a" || wss[0].InstalledDependencies != nil {
+		t.Errorf("expected a at packages/a with no installed dependencies, got %+v", wss[0])
+	}
+	if wss[1].Path != "packages/b" || wss[1].License != "MIT" || !reflect.DeepEqual(wss[1].InstalledDependencies, map[string]string{"ms": "2.1.3"}) {
+		t.Errorf("expected b at packages/b with ms installed, got %+v", wss[1])
+	}
+}
+
+func TestLoadWorkspaceManifestsPnpm(t *testing.T) {
+	dir := writeTree(t, map[string]string{
+		"package.json":                   `{"name": "app", "version": "1.0.0"}`,
+		"pnpm-workspace.yaml":            "packages:\n  - 'packages/*'\n  - '!packages/excluded'\n",
+		"packages/a/package.json":        `{"name": "a", "version": "1.0.0"}`,
+		"packages/b/package.json":        `{"name": "b", "version": "2.0.0"}`,
+		"packages/excluded/package.json": `{"name": "excluded", "version": "1.0.0"}`,
+	})
+	defer os.RemoveAll(dir)
+
+	workspaces, err := LoadWorkspaceManifests(dir, &PackageManifest{Name: "app", Version: "1.0.0"})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if paths := getWorkspacePaths(workspaces); !reflect.DeepEqual(paths, []string{"packages/a", "packages/b"}) {
+		t.Errorf("expected packages/a and packages/b, got %v", paths)
+	}
+	if wm := workspaces["packages/b"]; wm == nil || wm.Name != "b" || wm.Version != "2.0.0" {
+		t.Errorf("expected b@2.0.0 at packages/b, got %+v", wm)
+	}
+}
@@ -0,0 +1,387 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright The Linux Foundation and npm-spdx contributors.
+
+package npm
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// ParseYarnLock takes a byte slice (from reading a Yarn classic
+// (v1) yarn.lock file), parses its custom format, and returns a
+// corresponding YarnLock object.
+func ParseYarnLock(b []byte) (*YarnLock, error) {
+	yl := &YarnLock{Entries: map[string]*YarnLockEntry{}}
+
+	var entry *YarnLockEntry
+	var section map[string]string
+
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		trimmed := strings.TrimLeft(line, " ")
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		indent := len(line) - len(trimmed)
+
+		switch {
+		case indent == 0:
+			// start of a new entry, listing the specifiers it satisfies
+			if !strings.HasSuffix(trimmed, ":") {
+				return nil, fmt.Errorf("line %d: expected entry specifiers ending in ':', got %q", lineNum, trimmed)
+			}
+			entry = &YarnLockEntry{}
+			section = nil
+			for _, spec := range strings.Split(strings.TrimSuffix(trimmed, ":"), ",") {
+				spec = unquoteYarnString(strings.TrimSpace(spec))
+				name, rng := splitYarnSpecifier(spec)
+				if name == "" {
+					return nil, fmt.Errorf("line %d: invalid specifier %q", lineNum, spec)
+				}
+				// aliases ("foo@npm:bar@^1.0.0") install the package
+				// named after "npm:" under the specifier's name
+				if strings.HasPrefix(rng, "npm:") {
+					if real, _ := splitYarnSpecifier(strings.TrimPrefix(rng, "npm:")); real != "" {
+						name = real
+					}
+				}
+				// an entry that satisfies any non-registry
+				// specifier isn't from the registry
+				if entry.Protocol == "" || entry.Protocol == "npm" {
+					entry.Protocol = getYarnRangeProtocol(rng)
+				}
+				entry.Name = name
+				entry.Specifiers = append(entry.Specifiers, spec)
+				yl.Entries[spec] = entry
+			}
+
+		case entry == nil:
+			return nil, fmt.Errorf("line %d: field outside of any entry", lineNum)
+
+		case indent == 2:
+			key, val := splitYarnField(trimmed)
+			section = nil
+			if val == "" && strings.HasSuffix(key, ":") {
+				// start of a nested section, e.g. "dependencies:"
+				switch strings.TrimSuffix(key, ":") {
+				case "dependencies":
+					entry.Dependencies = map[string]string{}
+					section = entry.Dependencies
+				case "optionalDependencies":
+					entry.OptionalDependencies = map[string]string{}
+					section = entry.OptionalDependencies
+				default:
+					// some other section we don't need; its fields
+					// will be ignored below
+					section = map[string]string{}
+				}
+				continue
+			}
+			switch key {
+			case "version":
+				entry.Version = val
+			case "resolved":
+				entry.Resolved = val
+				// a registry range may still have been resolved
+				// elsewhere, e.g. by a "resolutions" override
+				if entry.Protocol == "npm" {
+					entry.Protocol = getYarnResolvedProtocol(val)
+				}
+			case "integrity":
+				entry.Integrity = val
+			}
+
+		default:
+			// field within a nested section
+			if section == nil {
+				return nil, fmt.Errorf("line %d: unexpected indentation", lineNum)
+			}
+			key, val := splitYarnField(trimmed)
+			section[key] = val
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading yarn.lock: %v", err)
+	}
+
+	return yl, nil
+}
+
+// splitYarnField splits a yarn.lock line of the form `key value`
+// into its (unquoted) key and value. The value is empty if the
+// line has only a key.
+func splitYarnField(s string) (string, string) {
+	var key, rest string
+	if strings.HasPrefix(s, `"`) {
+		// quoted key may contain spaces
+		end := strings.Index(s[1:], `"`)
+		if end < 0 {
+			return s, ""
+		}
+		key = s[1 : end+1]
+		rest = s[end+2:]
+	} else {
+		sp := strings.IndexByte(s, ' ')
+		if sp < 0 {
+			return s, ""
+		}
+		key = s[:sp]
+		rest = s[sp:]
+	}
+
+	return key, unquoteYarnString(strings.TrimSpace(rest))
+}
+
+// unquoteYarnString removes the double quotes around a yarn.lock
+// string, if any.
+func unquoteYarnString(s string) string {
+	if strings.HasPrefix(s, `"`) {
+		if u, err := strconv.Unquote(s); err == nil {
+			return u
+		}
+	}
+	return s
+}
+
+// splitYarnSpecifier splits a "name@range" specifier into its
+// package name and range. Scoped package names begin with "@",
+// so the separator is the first "@" after the first character.
+func splitYarnSpecifier(spec string) (string, string) {
+	if len(spec) < 2 {
+		return "", ""
+	}
+	i := strings.IndexByte(spec[1:], '@')
+	if i < 0 {
+		return spec, ""
+	}
+	return spec[:i+1], spec[i+2:]
+}
+
+// getYarnRangeProtocol returns the protocol of a Yarn classic
+// range: "npm" for registry ranges (including semver ranges, tags
+// and "npm:" aliases), or e.g. "file", "link", "git", "github" or
+// "https" for packages installed from elsewhere.
+func getYarnRangeProtocol(rng string) string {
+	switch {
+	case strings.HasPrefix(rng, "npm:"):
+		return "npm"
+	case strings.HasPrefix(rng, "git+"), strings.HasPrefix(rng, "git://"),
+		strings.HasPrefix(rng, "git@"), strings.HasSuffix(rng, ".git"):
+		return "git"
+	}
+	if i := strings.IndexByte(rng, ':'); i > 0 {
+		return rng[:i]
+	}
+	if strings.Contains(rng, "/") {
+		// "owner/repo" shorthand for a GitHub repository, or a
+		// local path
+		if strings.HasPrefix(rng, ".") || strings.HasPrefix(rng, "/") || strings.HasPrefix(rng, "~") {
+			return "file"
+		}
+		return "github"
+	}
+	return "npm"
+}
+
+// getYarnResolvedProtocol returns the protocol of a Yarn classic
+// "resolved" value: "npm" for tarball URLs, which is how registry
+// packages are recorded, or e.g. "file" or "git" otherwise.
+func getYarnResolvedProtocol(resolved string) string {
+	switch {
+	case strings.HasPrefix(resolved, "git+"), strings.HasPrefix(resolved, "git://"),
+		strings.HasPrefix(resolved, "https://codeload.github.com/"):
+		return "git"
+	case strings.HasPrefix(resolved, "http://"), strings.HasPrefix(resolved, "https://"):
+		return "npm"
+	}
+	if i := strings.IndexByte(resolved, ':'); i > 0 {
+		return resolved[:i]
+	}
+	return "npm"
+}
+
+// yarnBerryLockEntry represents one entry in a Yarn Berry (v2+)
+// yarn.lock file, as it is parsed from YAML.
+type yarnBerryLockEntry struct {
+	Version      string            `yaml:"version"`
+	Resolution   string            `yaml:"resolution"`
+	Dependencies map[string]string `yaml:"dependencies"`
+	Checksum     string            `yaml:"checksum"`
+	LanguageName string            `yaml:"languageName"`
+	LinkType     string            `yaml:"linkType"`
+}
+
+// ParseYarnBerryLock takes a byte slice (from reading a Yarn
+// Berry (v2+) yarn.lock file), parses its YAML, and returns a
+// corresponding YarnLock object.
+func ParseYarnBerryLock(b []byte) (*YarnLock, error) {
+	raw := map[string]*yarnBerryLockEntry{}
+	err := yaml.Unmarshal(b, &raw)
+	if err != nil {
+		return nil, fmt.Errorf("error unmarshalling from YAML: %v", err)
+	}
+
+	yl := &YarnLock{Entries: map[string]*YarnLockEntry{}}
+	for specs, re := range raw {
+		if specs == "__metadata" || re == nil {
+			continue
+		}
+
+		// the resolution records the real package name (which
+		// differs from the specifiers' for aliases) and protocol
+		name, rest := splitYarnSpecifier(re.Resolution)
+		if name == "" {
+			return nil, fmt.Errorf("entry %q: invalid resolution %q", specs, re.Resolution)
+		}
+		protocol := ""
+		if i := strings.IndexByte(rest, ':'); i >= 0 {
+			protocol = rest[:i]
+		}
+
+		entry := &YarnLockEntry{
+			Name:         name,
+			Version:      re.Version,
+			Resolved:     re.Resolution,
+			Integrity:    re.Checksum,
+			Protocol:     protocol,
+			LinkType:     re.LinkType,
+			Dependencies: re.Dependencies,
+		}
+		for _, spec := range strings.Split(specs, ",") {
+			spec = strings.TrimSpace(spec)
+			entry.Specifiers = append(entry.Specifiers, spec)
+			yl.Entries[spec] = entry
+		}
+	}
+
+	return yl, nil
+}
+
+// isRegistryEntry returns whether the YarnLockEntry refers to a
+// package version that can be looked up in the registry. This
+// excludes Yarn Berry workspaces and links, which are internal
+// packages, as well as git, file and tarball URL resolutions in
+// either format. Patch resolutions are also excluded, since
+// requirements on them are resolved to the registry package that
+// they patch instead.
+func (e *YarnLockEntry) isRegistryEntry() bool {
+	return e.Protocol == "npm"
+}
+
+// lookup finds the entry that a "name": "range" requirement was
+// resolved to. Yarn Berry lockfiles record registry ranges with
+// an explicit "npm:" protocol in their specifiers, but not in
+// their dependency lists. Patched packages are looked up as the
+// registry package that they patch.
+func (yl *YarnLock) lookup(name string, rng string) (*YarnLockEntry, bool) {
+	if inner, ok := getYarnPatchedDescriptor(rng); ok {
+		name, rng = splitYarnSpecifier(inner)
+	}
+	if e, ok := yl.Entries[name+"@"+rng]; ok {
+		return e, true
+	}
+	e, ok := yl.Entries[name+"@npm:"+rng]
+	return e, ok
+}
+
+// getYarnPatchedDescriptor takes a Yarn Berry range, and if it
+// is a "patch:" range (e.g. "patch:resolve@npm%3A^1.20.0#~builtin<compat/resolve>"),
+// returns the "name@range" descriptor of the package that it
+// patches, e.g. "resolve@npm:^1.20.0".
+func getYarnPatchedDescriptor(rng string) (string, bool) {
+	if !strings.HasPrefix(rng, "patch:") {
+		return "", false
+	}
+	inner := strings.TrimPrefix(rng, "patch:")
+	if i := strings.IndexByte(inner, '#'); i >= 0 {
+		inner = inner[:i]
+	}
+	inner, err := url.PathUnescape(inner)
+	if err != nil {
+		return "", false
+	}
+	if name, _ := splitYarnSpecifier(inner); name == "" {
+		return "", false
+	}
+	return inner, true
+}
+
+// GetLockDependencies returns every registry package version
+// recorded in the YarnLock, in the form consumed by
+// GetAllDependencies. Since yarn.lock doesn't record install
+// paths, entries are keyed by DependencyKey. Each entry's
+// InstalledDependencies is resolved by looking up its
+// "name@range" requirements in the YarnLock.
+//
+// The map also contains an entry for the root package under the
+// empty key "", whose InstalledDependencies is resolved from the
+// dependencies listed in manifest; and likewise an entry for each
+// workspace package, keyed by its path relative to the root.
+func (yl *YarnLock) GetLockDependencies(manifest *PackageManifest, workspaces map[string]*PackageManifest) map[string]*PackageLockDependency {
+	deps := map[string]*PackageLockDependency{}
+
+	for _, e := range yl.Entries {
+		if !e.isRegistryEntry() {
+			continue
+		}
+		key := DependencyKey(e.Name, e.Version)
+		if _, ok := deps[key]; ok {
+			continue
+		}
+
+		d := &PackageLockDependency{
+			Name:                  e.Name,
+			Version:               e.Version,
+			Resolved:              e.Resolved,
+			Integrity:             e.Integrity,
+			Requires:              map[string]string{},
+			InstalledDependencies: map[string]string{},
+		}
+		for _, reqs := range []map[string]string{e.Dependencies, e.OptionalDependencies} {
+			for reqName, reqRange := range reqs {
+				d.Requires[reqName] = reqRange
+				if inst, ok := yl.lookup(reqName, reqRange); ok && inst.isRegistryEntry() {
+					d.InstalledDependencies[reqName] = installedVersion(reqName, inst.Name, inst.Version)
+				}
+			}
+		}
+		deps[key] = d
+	}
+
+	deps[""] = yl.resolveManifest(manifest)
+	for path, wm := range workspaces {
+		d := yl.resolveManifest(wm)
+		d.IsWorkspace = true
+		deps[path] = d
+	}
+
+	return deps
+}
+
+// resolveManifest returns an entry for a package being developed
+// locally, such as the root or a workspace package, with its
+// dependencies resolved by looking them up in the YarnLock.
+func (yl *YarnLock) resolveManifest(manifest *PackageManifest) *PackageLockDependency {
+	d := &PackageLockDependency{
+		Name:                  manifest.Name,
+		Version:               manifest.Version,
+		Requires:              manifest.getAllRequires(),
+		InstalledDependencies: map[string]string{},
+	}
+	for reqName, reqRange := range d.Requires {
+		if inst, ok := yl.lookup(reqName, reqRange); ok && inst.isRegistryEntry() {
+			d.InstalledDependencies[reqName] = installedVersion(reqName, inst.Name, inst.Version)
+		}
+	}
+	return d
+}
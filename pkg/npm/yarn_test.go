@@ -0,0 +1,358 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright The Linux Foundation and npm-spdx contributors.
+
+package npm
+
+import (
+	"reflect"
+	"testing"
+)
+
+const yarnV1Lock = `# THIS IS AN AUTOGENERATED FILE. DO NOT EDIT THIS FILE DIRECTLY.
+# yarn lockfile v1
+
+
+"@babel/code-frame@^7.0.0":
+  version "7.0.0"
+  resolved "https://registry.yarnpkg.com/@babel/code-frame/-/code-frame-7.0.0.tgz#06e2ab19bdb535385559aabb5ba59729482800f8"
+  integrity sha512-OfC2uemaknXr87bdLUkWog7nYuliM9Ij5HUcajsVcMCpQrcLmtxRbVFTIqmcSkSeYRBFBRxs2FiUqFJDLdiebA==
+  dependencies:
+    "@babel/highlight" "^7.0.0"
+
+"@babel/highlight@^7.0.0":
+  version "7.0.0"
+
+debug@^4.1.0, debug@^4.1.1:
+  version "4.1.1"
+  dependencies:
+    ms "^2.1.1"
+  optionalDependencies:
+    fsevents "^1.2.7"
+
+foo@npm:ms@^2.0.0:
+  version "2.0.0"
+
+ms@^2.1.1:
+  version "2.1.2"
+`
+
+func TestParseYarnLock(t *testing.T) {
+	yl, err := ParseYarnLock([]byte(yarnV1Lock))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	for _, tc := range []struct {
+		spec      string
+		name      string
+		version   string
+		integrity string
+		deps      map[string]string
+		optDeps   map[string]string
+	}{
+		{"@babel/code-frame@^7.0.0", "@babel/code-frame", "7.0.0",
+			"sha512-OfC2uemaknXr87bdLUkWog7nYuliM9Ij5HUcajsVcMCpQrcLmtxRbVFTIqmcSkSeYRBFBRxs2FiUqFJDLdiebA==",
+			map[string]string{"@babel/highlight": "^7.0.0"}, nil},
+		{"@babel/highlight@^7.0.0", "@babel/highlight", "7.0.0", "", nil, nil},
+		{"debug@^4.1.0", "debug", "4.1.1", "", map[string]string{"ms": "^2.1.1"}, map[string]string{"fsevents": "^1.2.7"}},
+		{"debug@^4.1.1", "debug", "4.1.1", "", map[string]string{"ms": "^2.1.1"}, map[string]string{"fsevents": "^1.2.7"}},
+		{"foo@npm:ms@^2.0.0", "ms", "2.0.0", "", nil, nil},
+		{"ms@^2.1.1", "ms", "2.1.2", "", nil, nil},
+	} {
+		t.Run(tc.spec, func(t *testing.T) {
+			e, ok := yl.Entries[tc.spec]
+			if !ok {
+				t.Fatalf("expected entry for %s", tc.spec)
+			}
+			if e.Name != tc.name || e.Version != tc.version || e.Integrity != tc.integrity {
+				t.Errorf("expected (%q, %q, %q), got (%q, %q, %q)", tc.name, tc.version, tc.integrity, e.Name, e.Version, e.Integrity)
+			}
+			if !reflect.DeepEqual(e.Dependencies, tc.deps) {
+				t.Errorf("expected dependencies %v, got %v", tc.deps, e.Dependencies)
+			}
+			if !reflect.DeepEqual(e.OptionalDependencies, tc.optDeps) {
+				t.Errorf("expected optional dependencies %v, got %v", tc.optDeps, e.OptionalDependencies)
+			}
+		})
+	}
+	if len(yl.Entries) != 6 {
+		t.Errorf("expected 6 entries, got %d", len(yl.Entries))
+	}
+	if yl.Entries["debug@^4.1.0"] != yl.Entries["debug@^4.1.1"] {
+		t.Errorf("expected debug specifiers to share one entry")
+	}
+}
+
+func TestParseYarnLockErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		lock string
+	}{
+		{"missing colon", "# yarn lockfile v1\nfoo@^1.0.0\n  version \"1.0.0\"\n"},
+		{"field outside entry", "# yarn lockfile v1\n  version \"1.0.0\"\n"},
+		{"unexpected indentation", "# yarn lockfile v1\nfoo@^1.0.0:\n    bar \"1.0.0\"\n"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := ParseYarnLock([]byte(tc.lock)); err == nil {
+				t.Errorf("expected error, got nil")
+			}
+		})
+	}
+}
+
+func TestYarnLockGetLockDependencies(t *testing.T) {
+	yl, err := ParseYarnLock([]byte(yarnV1Lock))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	manifest := &PackageManifest{
+		Name:         "app",
+		Version:      "1.0.0",
+		Dependencies: map[string]string{"debug": "^4.1.0", "foo": "npm:ms@^2.0.0"},
+	}
+
+	deps := yl.GetLockDependencies(manifest, nil)
+	for _, tc := range []struct {
+		key       string
+		installed map[string]string
+	}{
+		{"", map[string]string{"debug": "4.1.1", "foo": "npm:ms@2.0.0"}},
+		{"debug@4.1.1", map[string]string{"ms": "2.1.2"}},
+		{"ms@2.0.0", map[string]string{}},
+		{"ms@2.1.2", map[string]string{}},
+		{"@babel/code-frame@7.0.0", map[string]string{"@babel/highlight": "7.0.0"}},
+	} {
+		d, ok := deps[tc.key]
+		if !ok {
+			t.Errorf("%q: expected entry", tc.key)
+			continue
+		}
+		if !reflect.DeepEqual(d.InstalledDependencies, tc.installed) {
+			t.Errorf("%q: expected installed %v, got %v", tc.key, tc.installed, d.InstalledDependencies)
+		}
+	}
+	if _, ok := deps["foo@2.0.0"]; ok {
+		t.Errorf("expected alias not to be recorded under its own name")
+	}
+}
+
+const yarnV1NonRegistryLock = `# yarn lockfile v1
+
+
+"gitdep@git+https://github.com/example/gitdep.git#v2.0.0":
+  version "2.0.0"
+  resolved "git+https://github.com/example/gitdep.git#0123456789abcdef0123456789abcdef01234567"
+  dependencies:
+    ms "^2.1.1"
+
+"local@file:../local":
+  version "1.0.0"
+
+ms@^2.1.1:
+  version "2.1.2"
+  resolved "https://registry.yarnpkg.com/ms/-/ms-2.1.2.tgz#d09d1f357b443f493382a8eb3ccd183872ae6009"
+
+overridden@^1.0.0:
+  version "1.0.0"
+  resolved "file:../overridden-1.0.0.tgz"
+
+shorthand@example/shorthand:
+  version "3.0.0"
+  resolved "https://codeload.github.com/example/shorthand/tar.gz/0123456789abcdef0123456789abcdef01234567"
+
+tarball@https://example.com/tarball-1.0.0.tgz:
+  version "1.0.0"
+  resolved "https://example.com/tarball-1.0.0.tgz"
+`
+
+func TestYarnLockSkipsNonRegistryEntries(t *testing.T) {
+	yl, err := ParseYarnLock([]byte(yarnV1NonRegistryLock))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	for _, tc := range []struct {
+		spec     string
+		protocol string
+	}{
+		{"gitdep@git+https://github.com/example/gitdep.git#v2.0.0", "git"},
+		{"local@file:../local", "file"},
+		{"ms@^2.1.1", "npm"},
+		{"overridden@^1.0.0", "file"},
+		{"shorthand@example/shorthand", "github"},
+		{"tarball@https://example.com/tarball-1.0.0.tgz", "https"},
+	} {
+		if e := yl.Entries[tc.spec]; e == nil || e.Protocol != tc.protocol {
+			t.Errorf("%s: expected protocol %q, got %+v", tc.spec, tc.protocol, e)
+		}
+	}
+
+	manifest := &PackageManifest{
+		Name:    "app",
+		Version: "1.0.0",
+		Dependencies: map[string]string{
+			"gitdep":     "git+https://github.com/example/gitdep.git#v2.0.0",
+			"local":      "file:../local",
+			"ms":         "^2.1.1",
+			"overridden": "^1.0.0",
+			"shorthand":  "example/shorthand",
+			"tarball":    "https://example.com/tarball-1.0.0.tgz",
+		},
+	}
+	deps := yl.GetLockDependencies(manifest, nil)
+	want := []string{"", "ms@2.1.2"}
+	if len(deps) != len(want) {
+		t.Errorf("expected only %v, got %d entries", want, len(deps))
+	}
+	for _, key := range want {
+		if _, ok := deps[key]; !ok {
+			t.Errorf("expected entry for %q", key)
+		}
+	}
+	if got := deps[""].InstalledDependencies; !reflect.DeepEqual(got, map[string]string{"ms": "2.1.2"}) {
+		t.Errorf("expected root to have only ms installed from the registry, got %v", got)
+	}
+}
+
+const yarnBerryLock = `# This file is generated by running "yarn install" inside your project.
+# Manual changes might be lost - proceed with caution!
+
+__metadata:
+  version: 6
+  cacheKey: 8
+
+"app@workspace:.":
+  version: 0.0.0-use.local
+  resolution: "app@workspace:."
+  dependencies:
+    foo: "npm:ms@^2.0.0"
+    lib: "workspace:packages/lib"
+    resolve: "patch:resolve@npm%3A^1.20.0#~builtin<compat/resolve>"
+  languageName: unknown
+  linkType: soft
+
+"foo@npm:ms@^2.0.0":
+  version: 2.0.0
+  resolution: "ms@npm:2.0.0"
+  checksum: 0e6a22b8b746d2e0b65a430519934fefd41b6db0682e3477c10f60c76e947c4c0ad06f63ffdf1d78d335f83edee8c0aa928aa66a36c7cd95b69b26f468d527f4
+  languageName: node
+  linkType: hard
+
+"lib@workspace:packages/lib":
+  version: 0.0.0-use.local
+  resolution: "lib@workspace:packages/lib"
+  languageName: unknown
+  linkType: soft
+
+"resolve@npm:^1.20.0":
+  version: 1.22.1
+  resolution: "resolve@npm:1.22.1"
+  dependencies:
+    path-parse: ^1.0.7
+  languageName: node
+  linkType: hard
+
+"resolve@patch:resolve@npm%3A^1.20.0#~builtin<compat/resolve>":
+  version: 1.22.1
+  resolution: "resolve@patch:resolve@npm%3A1.22.1#~builtin<compat/resolve>::version=1.22.1&hash=07638b"
+  dependencies:
+    path-parse: ^1.0.7
+  languageName: node
+  linkType: hard
+
+"path-parse@npm:^1.0.7":
+  version: 1.0.7
+  resolution: "path-parse@npm:1.0.7"
+  languageName: node
+  linkType: hard
+`
+
+func TestParseYarnBerryLock(t *testing.T) {
+	yl, err := ParseYarnBerryLock([]byte(yarnBerryLock))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	for _, tc := range []struct {
+		spec     string
+		name     string
+		version  string
+		protocol string
+		registry bool
+	}{
+		{"app@workspace:.", "app", "0.0.0-use.local", "workspace", false},
+		{"foo@npm:ms@^2.0.0", "ms", "2.0.0", "npm", true},
+		{"lib@workspace:packages/lib", "lib", "0.0.0-use.local", "workspace", false},
+		{"resolve@npm:^1.20.0", "resolve", "1.22.1", "npm", true},
+		{"resolve@patch:resolve@npm%3A^1.20.0#~builtin<compat/resolve>", "resolve", "1.22.1", "patch", false},
+		{"path-parse@npm:^1.0.7", "path-parse", "1.0.7", "npm", true},
+	} {
+		t.Run(tc.spec, func(t *testing.T) {
+			e, ok := yl.Entries[tc.spec]
+			if !ok {
+				t.Fatalf("expected entry for %s", tc.spec)
+			}
+			if e.Name != tc.name || e.Version != tc.version || e.Protocol != tc.protocol {
+				t.Errorf("expected (%q, %q, %q), got (%q, %q, %q)", tc.name, tc.version, tc.protocol, e.Name, e.Version, e.Protocol)
+			}
+			if e.isRegistryEntry() != tc.registry {
+				t.Errorf("expected isRegistryEntry %v, got %v", tc.registry, e.isRegistryEntry())
+			}
+		})
+	}
+}
+
+func TestGetYarnPatchedDescriptor(t *testing.T) {
+	for _, tc := range []struct {
+		rng   string
+		inner string
+		ok    bool
+	}{
+		{"patch:resolve@npm%3A^1.20.0#~builtin<compat/resolve>", "resolve@npm:^1.20.0", true},
+		{"patch:@scope/pkg@npm%3A1.0.0#./patches/pkg.patch::locator=app%40workspace%3A.", "@scope/pkg@npm:1.0.0", true},
+		{"patch:resolve@^1.20.0", "resolve@^1.20.0", true},
+		{"npm:^1.20.0", "", false},
+		{"^1.20.0", "", false},
+	} {
+		inner, ok := getYarnPatchedDescriptor(tc.rng)
+		if inner != tc.inner || ok != tc.ok {
+			t.Errorf("%q: expected (%q, %v), got (%q, %v)", tc.rng, tc.inner, tc.ok, inner, ok)
+		}
+	}
+}
+
+func TestYarnBerryLockGetLockDependencies(t *testing.T) {
+	yl, err := ParseYarnBerryLock([]byte(yarnBerryLock))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	manifest := &PackageManifest{
+		Name:    "app",
+		Version: "1.0.0",
+		Dependencies: map[string]string{
+			"foo":     "npm:ms@^2.0.0",
+			"lib":     "workspace:packages/lib",
+			"resolve": "patch:resolve@npm%3A^1.20.0#~builtin<compat/resolve>",
+		},
+	}
+
+	deps := yl.GetLockDependencies(manifest, nil)
+	expected := map[string]map[string]string{
+		"":                 {"foo": "npm:ms@2.0.0", "resolve": "1.22.1"},
+		"ms@2.0.0":         {},
+		"resolve@1.22.1":   {"path-parse": "1.0.7"},
+		"path-parse@1.0.7": {},
+	}
+	if len(deps) != len(expected) {
+		t.Errorf("expected %d entries, got %d", len(expected), len(deps))
+	}
+	for key, installed := range expected {
+		d, ok := deps[key]
+		if !ok {
+			t.Errorf("%q: expected entry", key)
+			continue
+		}
+		if !reflect.DeepEqual(d.InstalledDependencies, installed) {
+			t.Errorf("%q: expected installed %v, got %v", key, installed, d.InstalledDependencies)
+		}
+	}
+}
@@ -0,0 +1,258 @@
+// Package registrytest records responses from an NPM registry
+// into a fixtures directory, and serves them again from a local
+// httptest server, so that code querying the registry can be
+// tested deterministically and without network access.
+// SPDX-License-Identifier: Apache-2.0
+// Copyright The Linux Foundation and npm-spdx contributors.
+package registrytest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Fixture is a recorded registry response, stored as a JSON file
+// in the fixtures directory.
+type Fixture struct {
+	Status      int    `json:"status"`
+	ETag        string `json:"etag,omitempty"`
+	ContentType string `json:"contentType,omitempty"`
+	// Body is the response body if it is valid JSON, as registry
+	// responses usually are; otherwise it is a JSON string
+	// containing the body, and IsText is true.
+	Body   json.RawMessage `json:"body"`
+	IsText bool            `json:"isText,omitempty"`
+}
+
+// GetFixturePath returns the path of the fixture file in dir for
+// the request URL's escaped path, e.g. "/@babel%2fcore/7.2.2". The
+// path is escaped again so that each fixture is a single file.
+func GetFixturePath(dir string, escapedPath string) string {
+	return filepath.Join(dir, url.PathEscape(strings.TrimPrefix(escapedPath, "/"))+".json")
+}
+
+// LoadFixture reads the fixture file at path.
+func LoadFixture(path string) (*Fixture, error) {
+	js, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading fixture %s: %v", path, err)
+	}
+
+	f := &Fixture{}
+	err = json.Unmarshal(js, f)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing fixture %s: %v", path, err)
+	}
+	return f, nil
+}
+
+// SaveFixture writes the fixture file at path.
+func SaveFixture(path string, f *Fixture) error {
+	js, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshalling fixture to JSON: %v", err)
+	}
+
+	err = ioutil.WriteFile(path, append(js, '\n'), 0644)
+	if err != nil {
+		return fmt.Errorf("error writing fixture %s: %v", path, err)
+	}
+	return nil
+}
+
+// GetBody returns the response body that the Fixture records.
+// JSON bodies are returned in compact form, which may differ in
+// whitespace from the original response.
+func (f *Fixture) GetBody() ([]byte, error) {
+	if !f.IsText {
+		var compacted bytes.Buffer
+		err := json.Compact(&compacted, f.Body)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing fixture body: %v", err)
+		}
+		return compacted.Bytes(), nil
+	}
+	var s string
+	err := json.Unmarshal(f.Body, &s)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing fixture body: %v", err)
+	}
+	return []byte(s), nil
+}
+
+// newFixture returns a Fixture recording a response with the
+// specified status, headers and body.
+func newFixture(status int, header http.Header, body []byte) *Fixture {
+	f := &Fixture{
+		Status:      status,
+		ETag:        header.Get("ETag"),
+		ContentType: header.Get("Content-Type"),
+	}
+	var compacted bytes.Buffer
+	if len(body) > 0 && json.Compact(&compacted, body) == nil {
+		f.Body = compacted.Bytes()
+	} else {
+		// marshalling a string can't fail
+		f.Body, _ = json.Marshal(string(body))
+		f.IsText = true
+	}
+	return f
+}
+
+// RecordingTransport is an http.RoundTripper that sends each
+// request using Transport (or http.DefaultTransport, if nil), and
+// saves the response as a Fixture in Dir before returning it.
+// Conditional requests are made unconditional, so that the
+// fixture always contains the full response.
+type RecordingTransport struct {
+	Dir       string
+	Transport http.RoundTripper
+	// PathPrefix, if set, is removed from the start of each
+	// request's escaped path when naming its fixture, e.g. "/npm"
+	// for a registry at "https://example.com/npm/".
+	PathPrefix string
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *RecordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	tr := t.Transport
+	if tr == nil {
+		tr = http.DefaultTransport
+	}
+
+	if req.Header.Get("If-None-Match") != "" {
+		req = req.Clone(req.Context())
+		req.Header.Del("If-None-Match")
+	}
+
+	res, err := tr.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("error reading response from %s: %v", req.URL, err)
+	}
+	res.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	// don't record transient failures
+	if res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= 500 {
+		return res, nil
+	}
+
+	err = os.MkdirAll(t.Dir, 0755)
+	if err != nil {
+		return nil, fmt.Errorf("error creating fixtures directory %s: %v", t.Dir, err)
+	}
+	path := GetFixturePath(t.Dir, strings.TrimPrefix(req.URL.EscapedPath(), t.PathPrefix))
+	err = SaveFixture(path, newFixture(res.StatusCode, res.Header, body))
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// NewRecordingServer returns a running httptest server that
+// forwards each request to the registry at upstream (e.g.
+// "https://registry.npmjs.org/"), recording the responses in dir
+// with a RecordingTransport. Point a client at the server's URL
+// to record the fixtures for its requests. The caller must Close
+// the server.
+func NewRecordingServer(dir string, upstream string) (*httptest.Server, error) {
+	base, err := url.Parse(strings.TrimSuffix(upstream, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid upstream registry URL %s: %v", upstream, err)
+	}
+	rt := &RecordingTransport{Dir: dir, PathPrefix: base.EscapedPath()}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u := *base
+		u.Path = base.Path + r.URL.Path
+		u.RawPath = base.EscapedPath() + r.URL.EscapedPath()
+
+		req, err := http.NewRequest(r.Method, u.String(), nil)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		req = req.WithContext(r.Context())
+		for _, h := range []string{"Accept", "Authorization", "User-Agent"} {
+			if v := r.Header.Get(h); v != "" {
+				req.Header.Set(h, v)
+			}
+		}
+
+		res, err := rt.RoundTrip(req)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		defer res.Body.Close()
+		body, _ := ioutil.ReadAll(res.Body)
+
+		// respond just as a replay server would
+		f := newFixture(res.StatusCode, res.Header, body)
+		body, err = f.GetBody()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		writeResponse(w, f, body)
+	})), nil
+}
+
+// NewReplayServer returns a running httptest server that responds
+// to each request with the Fixture recorded for its path in dir.
+// Requests without a fixture get a 404 response, and conditional
+// requests matching the fixture's ETag get a 304 response. The
+// caller must Close the server.
+func NewReplayServer(dir string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := GetFixturePath(dir, r.URL.EscapedPath())
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			http.Error(w, `{"error":"no fixture recorded"}`, http.StatusNotFound)
+			return
+		}
+
+		f, err := LoadFixture(path)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		body, err := f.GetBody()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if f.ETag != "" && r.Header.Get("If-None-Match") == f.ETag {
+			w.Header().Set("ETag", f.ETag)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		writeResponse(w, f, body)
+	}))
+}
+
+// writeResponse writes the status and headers recorded in the
+// Fixture, followed by body.
+func writeResponse(w http.ResponseWriter, f *Fixture, body []byte) {
+	if f.ETag != "" {
+		w.Header().Set("ETag", f.ETag)
+	}
+	if f.ContentType != "" {
+		w.Header().Set("Content-Type", f.ContentType)
+	}
+	w.WriteHeader(f.Status)
+	w.Write(body)
+}
@@ -0,0 +1,99 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright The Linux Foundation and npm-spdx contributors.
+
+package registrytest
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func get(t *testing.T, url string, etag string) (int, string) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		t.Fatalf("error creating request: %v", err)
+	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("error sending request: %v", err)
+	}
+	defer res.Body.Close()
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatalf("error reading response: %v", err)
+	}
+	return res.StatusCode, string(b)
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.EscapedPath() {
+		case "/npm/ms/2.1.2":
+			w.Header().Set("ETag", `"ms"`)
+			fmt.Fprint(w, `{"name": "ms", "version": "2.1.2", "license": "MIT"}`)
+		case "/npm/@babel%2Fcore/7.2.2":
+			fmt.Fprint(w, `{"name":"@babel/core","version":"7.2.2","license":"MIT"}`)
+		case "/npm/text/1.0.0":
+			fmt.Fprint(w, "not json")
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"error":"Not found"}`)
+		}
+	}))
+	defer upstream.Close()
+
+	dir, err := ioutil.TempDir("", "registrytest-")
+	if err != nil {
+		t.Fatalf("error creating temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	paths := []string{"/ms/2.1.2", "/@babel%2Fcore/7.2.2", "/text/1.0.0", "/missing/1.0.0"}
+
+	// record each response, including the 404
+	rec, err := NewRecordingServer(dir, upstream.URL+"/npm/")
+	if err != nil {
+		t.Fatalf("error starting recording server: %v", err)
+	}
+	recorded := map[string]string{}
+	statuses := map[string]int{}
+	for _, p := range paths {
+		statuses[p], recorded[p] = get(t, rec.URL+p, "")
+	}
+	rec.Close()
+
+	// and then upstream isn't needed to replay them
+	upstream.Close()
+	srv := NewReplayServer(dir)
+	defer srv.Close()
+
+	for _, p := range paths {
+		status, body := get(t, srv.URL+p, "")
+		if status != statuses[p] {
+			t.Errorf("%s: expected status %d, got %d", p, statuses[p], status)
+		}
+		if body != recorded[p] {
+			t.Errorf("%s: expected body %q, got %q", p, recorded[p], body)
+		}
+	}
+	if statuses["/missing/1.0.0"] != http.StatusNotFound {
+		t.Errorf("expected 404 to be recorded, got %d", statuses["/missing/1.0.0"])
+	}
+
+	// conditional requests are honored
+	if status, _ := get(t, srv.URL+"/ms/2.1.2", `"ms"`); status != http.StatusNotModified {
+		t.Errorf("expected 304 for matching ETag, got %d", status)
+	}
+
+	// and requests that weren't recorded aren't found
+	if status, _ := get(t, srv.URL+"/ms/1.0.0", ""); status != http.StatusNotFound {
+		t.Errorf("expected 404 without fixture, got %d", status)
+	}
+}
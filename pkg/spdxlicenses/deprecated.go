@@ -0,0 +1,125 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright The Linux Foundation and npm-spdx contributors.
+
+package spdxlicenses
+
+import (
+	"sort"
+)
+
+// deprecatedReplacements maps deprecated license IDs that aren't
+// simply replaced by their "-only" or "-or-later" forms to the
+// license expressions that replace them.
+var deprecatedReplacements = map[string]string{
+	"GPL-2.0-with-GCC-exception":       "GPL-2.0-only WITH GCC-exception-2.0",
+	"GPL-2.0-with-autoconf-exception":  "GPL-2.0-only WITH Autoconf-exception-2.0",
+	"GPL-2.0-with-bison-exception":     "GPL-2.0-only WITH Bison-exception-2.2",
+	"GPL-2.0-with-classpath-exception": "GPL-2.0-only WITH Classpath-exception-2.0",
+	"GPL-2.0-with-font-exception":      "GPL-2.0-only WITH Font-exception-2.0",
+	"GPL-3.0-with-GCC-exception":       "GPL-3.0-only WITH GCC-exception-3.1",
+	"GPL-3.0-with-autoconf-exception":  "GPL-3.0-only WITH Autoconf-exception-3.0",
+	"eCos-2.0":                         "GPL-2.0-or-later WITH eCos-exception-2.0",
+	"wxWindows":                        "LGPL-2.0-or-later WITH WxWindows-exception-3.1",
+	"Nunit":                            "Zlib-acknowledgement",
+	"StandardML-NJ":                    "SMLNJ",
+}
+
+// GetDeprecatedIDs returns the deprecated license and license
+// exception IDs used in expr, sorted and without duplicates.
+// Licenses are returned as written, e.g. "GPL-2.0+".
+func GetDeprecatedIDs(expr Expression, c *Catalog) []string {
+	found := map[string]bool{}
+	var walk func(Expression)
+	walk = func(expr Expression) {
+		switch e := expr.(type) {
+		case *SimpleExpression:
+			if c.IsDeprecated(e.ID) {
+				found[e.String()] = true
+			}
+		case *WithExpression:
+			walk(e.License)
+			if c.IsDeprecated(e.Exception) {
+				found[e.Exception] = true
+			}
+		case *CompoundExpression:
+			walk(e.Left)
+			walk(e.Right)
+		}
+	}
+	walk(expr)
+
+	ids := []string{}
+	for id := range found {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// UpgradeDeprecatedIDs returns expr with its deprecated license
+// IDs replaced by their current equivalents, e.g. "GPL-2.0" by
+// "GPL-2.0-only" and "GPL-2.0+" by "GPL-2.0-or-later". Licenses
+// are only replaced by IDs that are in the Catalog; deprecated IDs
+// with no replacement are kept.
+func UpgradeDeprecatedIDs(expr Expression, c *Catalog) Expression {
+	switch e := expr.(type) {
+	case *SimpleExpression:
+		return upgradeLicense(e, c)
+
+	case *WithExpression:
+		// the license can't itself become a WITH expression
+		if lic, ok := upgradeLicense(e.License, c).(*SimpleExpression); ok {
+			return &WithExpression{License: lic, Exception: e.Exception}
+		}
+		return e
+
+	case *CompoundExpression:
+		return &CompoundExpression{
+			Operator: e.Operator,
+			Left:     UpgradeDeprecatedIDs(e.Left, c),
+			Right:    UpgradeDeprecatedIDs(e.Right, c),
+		}
+	}
+
+	return expr
+}
+
+func upgradeLicense(e *SimpleExpression, c *Catalog) Expression {
+	if !c.IsDeprecated(e.ID) {
+		return e
+	}
+
+	if r, ok := deprecatedReplacements[e.ID]; ok && !e.OrLater {
+		expr, err := ParseExpression(r)
+		if err == nil && validate(expr, c) == nil {
+			return expr
+		}
+		return e
+	}
+
+	// e.g. the GNU licenses
+	if e.OrLater && c.IsLicense(e.ID+"-or-later") {
+		return &SimpleExpression{ID: e.ID + "-or-later"}
+	}
+	if !e.OrLater && c.IsLicense(e.ID+"-only") {
+		return &SimpleExpression{ID: e.ID + "-only"}
+	}
+	return e
+}
+
+// UpgradeDeprecatedExpression parses s as a license expression
+// and, if it uses any deprecated license IDs that can be
+// upgraded, returns it with them replaced (as described for
+// UpgradeDeprecatedIDs) and true. Otherwise, it returns s
+// unchanged and false.
+func UpgradeDeprecatedExpression(s string, c *Catalog) (string, bool) {
+	expr, err := ParseExpression(s)
+	if err != nil {
+		return s, false
+	}
+	upgraded := UpgradeDeprecatedIDs(expr, c).String()
+	if upgraded == expr.String() {
+		return s, false
+	}
+	return upgraded, true
+}
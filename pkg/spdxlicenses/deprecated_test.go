@@ -0,0 +1,43 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright The Linux Foundation and npm-spdx contributors.
+
+package spdxlicenses
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestUpgradeDeprecatedExpression(t *testing.T) {
+	c := loadTestCatalog(t)
+
+	for _, tc := range []struct {
+		s        string
+		ids      []string
+		expected string
+		upgraded bool
+	}{
+		{"MIT", []string{}, "MIT", false},
+		{"(MIT OR GPL-3.0-only)", []string{}, "(MIT OR GPL-3.0-only)", false},
+		{"GPL-2.0", []string{"GPL-2.0"}, "GPL-2.0-only", true},
+		{"GPL-2.0+", []string{"GPL-2.0+"}, "GPL-2.0-or-later", true},
+		{"(BSD-3-Clause OR GPL-2.0)", []string{"GPL-2.0"}, "BSD-3-Clause OR GPL-2.0-only", true},
+		{"LGPL-2.1 AND LGPL-2.1+ AND LGPL-2.1", []string{"LGPL-2.1", "LGPL-2.1+"}, "LGPL-2.1-only AND LGPL-2.1-or-later AND LGPL-2.1-only", true},
+		{"GPL-2.0 WITH Classpath-exception-2.0", []string{"GPL-2.0"}, "GPL-2.0-only WITH Classpath-exception-2.0", true},
+		{"MIT OR GPL-2.0-with-classpath-exception", []string{"GPL-2.0-with-classpath-exception"}, "MIT OR GPL-2.0-only WITH Classpath-exception-2.0", true},
+		{"LGPL-2.1-only WITH Nokia-Qt-exception-1.1", []string{"Nokia-Qt-exception-1.1"}, "LGPL-2.1-only WITH Nokia-Qt-exception-1.1", false},
+	} {
+		expr, err := ParseExpression(tc.s)
+		if err != nil {
+			t.Errorf("%q: expected no error, got %v", tc.s, err)
+			continue
+		}
+		if ids := GetDeprecatedIDs(expr, c); !reflect.DeepEqual(ids, tc.ids) {
+			t.Errorf("%q: expected deprecated IDs %v, got %v", tc.s, tc.ids, ids)
+		}
+		upgraded, ok := UpgradeDeprecatedExpression(tc.s, c)
+		if upgraded != tc.expected || ok != tc.upgraded {
+			t.Errorf("%q: expected (%q, %v), got (%q, %v)", tc.s, tc.expected, tc.upgraded, upgraded, ok)
+		}
+	}
+}
@@ -0,0 +1,436 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright The Linux Foundation and npm-spdx contributors.
+
+package spdxlicenses
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Expression is a parsed SPDX license expression: a
+// *SimpleExpression, a *WithExpression or a *CompoundExpression.
+type Expression interface {
+	// String returns the expression in SPDX syntax, with
+	// parentheses only where they are needed.
+	String() string
+}
+
+// SimpleExpression is a single license: either an ID from the
+// SPDX License List, optionally followed by "+", or a
+// "LicenseRef-" (possibly prefixed by a "DocumentRef-").
+type SimpleExpression struct {
+	ID      string
+	OrLater bool
+}
+
+// WithExpression is a license together with a license exception
+// from the SPDX License List, joined by "WITH".
+type WithExpression struct {
+	License   *SimpleExpression
+	Exception string
+}
+
+// CompoundExpression joins two expressions with "AND" or "OR".
+type CompoundExpression struct {
+	Operator string
+	Left     Expression
+	Right    Expression
+}
+
+// String returns the license ID, followed by "+" if OrLater.
+func (e *SimpleExpression) String() string {
+	if e.OrLater {
+		return e.ID + "+"
+	}
+	return e.ID
+}
+
+// IsLicenseRef returns whether the license is a "LicenseRef-"
+// rather than an ID from the SPDX License List.
+func (e *SimpleExpression) IsLicenseRef() bool {
+	return strings.HasPrefix(e.ID, "LicenseRef-") || strings.HasPrefix(e.ID, "DocumentRef-")
+}
+
+// String returns the license and exception joined by "WITH".
+func (e *WithExpression) String() string {
+	return e.License.String() + " WITH " + e.Exception
+}
+
+// String returns the two expressions joined by the operator,
+// with parentheses around either one that is an "OR" inside an
+// "AND", or that is a compound on the right-hand side.
+func (e *CompoundExpression) String() string {
+	left := e.Left.String()
+	if c, ok := e.Left.(*CompoundExpression); ok && c.Operator == "OR" && e.Operator == "AND" {
+		left = "(" + left + ")"
+	}
+	right := e.Right.String()
+	if c, ok := e.Right.(*CompoundExpression); ok && (c.Operator == "OR" || e.Operator == "AND") {
+		right = "(" + right + ")"
+	}
+	return left + " " + e.Operator + " " + right
+}
+
+// ParseError describes why a string is not a syntactically
+// valid license expression.
+type ParseError struct {
+	// Expression is the string that was being parsed.
+	Expression string
+	// Pos is the byte offset in Expression where the problem
+	// was found.
+	Pos int
+	// Msg describes the problem.
+	Msg string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("invalid license expression %q at position %d: %s", e.Expression, e.Pos, e.Msg)
+}
+
+type tokenKind int
+
+const (
+	tokenEnd tokenKind = iota
+	tokenLParen
+	tokenRParen
+	tokenAnd
+	tokenOr
+	tokenWith
+	tokenID
+)
+
+type token struct {
+	kind    tokenKind
+	pos     int
+	text    string
+	orLater bool
+}
+
+func (t token) describe() string {
+	switch t.kind {
+	case tokenEnd:
+		return "end of expression"
+	case tokenID:
+		if t.orLater {
+			return fmt.Sprintf("%q", t.text+"+")
+		}
+		return fmt.Sprintf("%q", t.text)
+	default:
+		return fmt.Sprintf("%q", t.text)
+	}
+}
+
+// isIDChar returns whether r may appear in a license ID, as an
+// SPDX "idstring", or as the ":" after a "DocumentRef-".
+func isIDChar(r byte) bool {
+	return (r >= 'A' && r <= 'Z') || (r >= 'a' && r <= 'z') ||
+		(r >= '0' && r <= '9') || r == '-' || r == '.' || r == ':'
+}
+
+// tokenize splits s into tokens. A "+" is only permitted
+// immediately after a license ID, and is recorded on its token.
+func tokenize(s string) ([]token, error) {
+	tokens := []token{}
+	i := 0
+	for i < len(s) {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(':
+			tokens = append(tokens, token{kind: tokenLParen, pos: i, text: "("})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{kind: tokenRParen, pos: i, text: ")"})
+			i++
+		case c == '+':
+			return nil, &ParseError{s, i, `"+" must immediately follow a license ID`}
+		case isIDChar(c):
+			start := i
+			for i < len(s) && isIDChar(s[i]) {
+				i++
+			}
+			t := token{kind: tokenID, pos: start, text: s[start:i]}
+			switch t.text {
+			case "AND":
+				t.kind = tokenAnd
+			case "OR":
+				t.kind = tokenOr
+			case "WITH":
+				t.kind = tokenWith
+			default:
+				if i < len(s) && s[i] == '+' {
+					t.orLater = true
+					i++
+				}
+			}
+			tokens = append(tokens, t)
+		default:
+			return nil, &ParseError{s, i, fmt.Sprintf("unexpected character %q", c)}
+		}
+	}
+	tokens = append(tokens, token{kind: tokenEnd, pos: len(s)})
+	return tokens, nil
+}
+
+// parser is a recursive-descent parser for the grammar in
+// Appendix IV of the SPDX 2.1 specification, in which WITH binds
+// more tightly than AND, which binds more tightly than OR.
+type parser struct {
+	s      string
+	tokens []token
+	i      int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.i]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.i]
+	if t.kind != tokenEnd {
+		p.i++
+	}
+	return t
+}
+
+func (p *parser) errorf(t token, format string, a ...interface{}) error {
+	return &ParseError{p.s, t.pos, fmt.Sprintf(format, a...)}
+}
+
+// ParseExpression parses s as an SPDX license expression, and
+// returns its syntax tree. It only checks the syntax, not whether
+// the IDs are on the SPDX License List; see ValidateExpression
+// for that. As in the SPDX specification, the operators AND, OR
+// and WITH must be upper case.
+func ParseExpression(s string) (Expression, error) {
+	tokens, err := tokenize(s)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{s: s, tokens: tokens}
+
+	if p.peek().kind == tokenEnd {
+		return nil, p.errorf(p.peek(), "expression is empty")
+	}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokenEnd {
+		return nil, p.unexpected(t, "an operator")
+	}
+	return expr, nil
+}
+
+// unexpected returns an error for finding t rather than what was
+// expected, pointing out lower-case operators.
+func (p *parser) unexpected(t token, expected string) error {
+	if t.kind == tokenID && !t.orLater {
+		switch upper := strings.ToUpper(t.text); upper {
+		case "AND", "OR", "WITH":
+			return p.errorf(t, "operator %q must be written as %q", t.text, upper)
+		}
+	}
+	if t.kind == tokenWith {
+		return p.errorf(t, "WITH must follow a single license ID")
+	}
+	return p.errorf(t, "expected %s, found %s", expected, t.describe())
+}
+
+func (p *parser) parseOr() (Expression, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokenOr {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &CompoundExpression{Operator: "OR", Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (Expression, error) {
+	left, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokenAnd {
+		p.next()
+		right, err := p.parsePrimary()
+		if err != nil {
+			return nil, err
+		}
+		left = &CompoundExpression{Operator: "AND", Left: left, Right: right}
+	}
+	return left, nil
+}
+
+// parsePrimary parses a parenthesized expression, or a license
+// optionally followed by WITH and an exception.
+func (p *parser) parsePrimary() (Expression, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenLParen:
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if rt := p.next(); rt.kind != tokenRParen {
+			if rt.kind == tokenEnd {
+				return nil, p.errorf(t, "unmatched \"(\"")
+			}
+			return nil, p.unexpected(rt, `an operator or ")"`)
+		}
+		return expr, nil
+
+	case tokenID:
+		lic, err := p.checkLicenseID(t)
+		if err != nil {
+			return nil, err
+		}
+		if p.peek().kind != tokenWith {
+			return lic, nil
+		}
+		p.next()
+		et := p.next()
+		if et.kind != tokenID {
+			return nil, p.unexpected(et, "a license exception ID after WITH")
+		}
+		if et.orLater {
+			return nil, p.errorf(et, `"+" cannot follow a license exception ID`)
+		}
+		if strings.Contains(et.text, ":") || strings.HasPrefix(et.text, "LicenseRef-") {
+			return nil, p.errorf(et, "%q is not a license exception ID", et.text)
+		}
+		return &WithExpression{License: lic, Exception: et.text}, nil
+
+	case tokenRParen:
+		return nil, p.errorf(t, "unmatched \")\"")
+
+	default:
+		return nil, p.unexpected(t, "a license ID or \"(\"")
+	}
+}
+
+// checkLicenseID returns the SimpleExpression for an ID token,
+// checking that a "DocumentRef-" is followed by a "LicenseRef-",
+// and that "+" does not follow a "LicenseRef-".
+func (p *parser) checkLicenseID(t token) (*SimpleExpression, error) {
+	id := t.text
+	if i := strings.IndexByte(id, ':'); i >= 0 {
+		doc, ref := id[:i], id[i+1:]
+		if !strings.HasPrefix(doc, "DocumentRef-") || len(doc) == len("DocumentRef-") {
+			return nil, p.errorf(t, `%q: ":" may only follow a "DocumentRef-"`, id)
+		}
+		if !strings.HasPrefix(ref, "LicenseRef-") || len(ref) == len("LicenseRef-") || strings.Contains(ref, ":") {
+			return nil, p.errorf(t, `%q: "DocumentRef-" must be followed by ":LicenseRef-"`, id)
+		}
+	} else if strings.HasPrefix(id, "DocumentRef-") {
+		return nil, p.errorf(t, `%q: "DocumentRef-" must be followed by ":LicenseRef-"`, id)
+	} else if id == "LicenseRef-" {
+		return nil, p.errorf(t, `%q: "LicenseRef-" must be followed by an ID`, id)
+	}
+
+	lic := &SimpleExpression{ID: id, OrLater: t.orLater}
+	if lic.OrLater && lic.IsLicenseRef() {
+		return nil, p.errorf(t, `"+" cannot follow a LicenseRef`)
+	}
+	return lic, nil
+}
+
+// ValidateExpression parses s as an SPDX license expression, and
+// checks that each license and exception is in the Catalog, that
+// license exceptions are only used after WITH, and that licenses
+// are not used after WITH. The whole expression may also be "NONE"
+// or "NOASSERTION". It returns the expression's syntax tree, which
+// is nil for "NONE" and "NOASSERTION".
+func ValidateExpression(s string, c *Catalog) (Expression, error) {
+	if s == "NONE" || s == "NOASSERTION" {
+		return nil, nil
+	}
+
+	expr, err := ParseExpression(s)
+	if err != nil {
+		return nil, err
+	}
+	err = validate(expr, c)
+	if err != nil {
+		return nil, fmt.Errorf("invalid license expression %q: %v", s, err)
+	}
+	return expr, nil
+}
+
+func validate(expr Expression, c *Catalog) error {
+	switch e := expr.(type) {
+	case *SimpleExpression:
+		switch {
+		case e.IsLicenseRef() || c.IsLicense(e.ID):
+			return nil
+		case c.IsException(e.ID):
+			return fmt.Errorf("%s is a license exception, and can only be used after WITH", e.ID)
+		case e.ID == "NONE" || e.ID == "NOASSERTION":
+			return fmt.Errorf("%s cannot be combined with other licenses", e.ID)
+		default:
+			return fmt.Errorf("%s is not on the SPDX License List", e.ID)
+		}
+
+	case *WithExpression:
+		err := validate(e.License, c)
+		if err != nil {
+			return err
+		}
+		switch {
+		case c.IsException(e.Exception):
+			return nil
+		case c.IsLicense(e.Exception):
+			return fmt.Errorf("%s is a license, not a license exception, and cannot be used after WITH", e.Exception)
+		default:
+			return fmt.Errorf("%s is not a license exception on the SPDX License List", e.Exception)
+		}
+
+	case *CompoundExpression:
+		err := validate(e.Left, c)
+		if err != nil {
+			return err
+		}
+		return validate(e.Right, c)
+	}
+
+	return fmt.Errorf("unknown expression type %T", expr)
+}
+
+// GetLicenseIDs returns the IDs of the licenses used in expr,
+// without any "+", sorted and without duplicates. LicenseRefs and
+// license exceptions are not included.
+func GetLicenseIDs(expr Expression) []string {
+	found := map[string]bool{}
+	var walk func(Expression)
+	walk = func(expr Expression) {
+		switch e := expr.(type) {
+		case *SimpleExpression:
+			if !e.IsLicenseRef() {
+				found[e.ID] = true
+			}
+		case *WithExpression:
+			walk(e.License)
+		case *CompoundExpression:
+			walk(e.Left)
+			walk(e.Right)
+		}
+	}
+	walk(expr)
+
+	ids := []string{}
+	for id := range found {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
@@ -0,0 +1,184 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright The Linux Foundation and npm-spdx contributors.
+
+package spdxlicenses
+
+import (
+	"strings"
+	"testing"
+)
+
+var testCatalog = &Catalog{
+	LicenseListVersion: "test",
+	Licenses: map[string]*License{
+		"MIT":          {ID: "MIT"},
+		"Apache-2.0":   {ID: "Apache-2.0"},
+		"BSD-3-Clause": {ID: "BSD-3-Clause"},
+		"GPL-2.0":      {ID: "GPL-2.0", IsDeprecated: true},
+		"GPL-2.0-only": {ID: "GPL-2.0-only"},
+		"ISC":          {ID: "ISC"},
+	},
+	Exceptions: map[string]*Exception{
+		"Classpath-exception-2.0": {ID: "Classpath-exception-2.0"},
+	},
+}
+
+// loadTestCatalog returns the Catalog for the license list in the
+// data directory.
+func loadTestCatalog(t *testing.T) *Catalog {
+	c, err := ParseJSONLicenses("../../data/licenses.json", "../../data/exceptions.json")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	return c
+}
+
+func TestParseExpression(t *testing.T) {
+	for _, tc := range []struct {
+		s        string
+		expected string
+	}{
+		{"MIT", "MIT"},
+		{"GPL-2.0+", "GPL-2.0+"},
+		{"(MIT)", "MIT"},
+		{"MIT OR Apache-2.0", "MIT OR Apache-2.0"},
+		{"(MIT OR Apache-2.0)", "MIT OR Apache-2.0"},
+		{"MIT AND ISC OR Apache-2.0", "MIT AND ISC OR Apache-2.0"},
+		{"MIT AND (ISC OR Apache-2.0)", "MIT AND (ISC OR Apache-2.0)"},
+		{"((MIT AND (ISC OR (Apache-2.0))))", "MIT AND (ISC OR Apache-2.0)"},
+		{"GPL-2.0-only WITH Classpath-exception-2.0 OR MIT", "GPL-2.0-only WITH Classpath-exception-2.0 OR MIT"},
+		{"LicenseRef-Proprietary AND DocumentRef-other:LicenseRef-1", "LicenseRef-Proprietary AND DocumentRef-other:LicenseRef-1"},
+	} {
+		expr, err := ParseExpression(tc.s)
+		if err != nil {
+			t.Errorf("%q: expected no error, got %v", tc.s, err)
+			continue
+		}
+		if expr.String() != tc.expected {
+			t.Errorf("%q: expected %q, got %q", tc.s, tc.expected, expr.String())
+		}
+	}
+}
+
+func TestParseExpressionPrecedence(t *testing.T) {
+	expr, err := ParseExpression("MIT OR ISC AND GPL-2.0+ WITH Classpath-exception-2.0")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	or, ok := expr.(*CompoundExpression)
+	if !ok || or.Operator != "OR" {
+		t.Fatalf("expected OR at top level, got %#v", expr)
+	}
+	and, ok := or.Right.(*CompoundExpression)
+	if !ok || and.Operator != "AND" {
+		t.Fatalf("expected AND on right of OR, got %#v", or.Right)
+	}
+	with, ok := and.Right.(*WithExpression)
+	if !ok {
+		t.Fatalf("expected WITH on right of AND, got %#v", and.Right)
+	}
+	if with.License.ID != "GPL-2.0" || !with.License.OrLater || with.Exception != "Classpath-exception-2.0" {
+		t.Errorf("expected GPL-2.0+ WITH Classpath-exception-2.0, got %#v", with)
+	}
+}
+
+func TestParseExpressionErrors(t *testing.T) {
+	for _, tc := range []struct {
+		s   string
+		pos int
+		msg string
+	}{
+		{"", 0, "empty"},
+		{"MIT OR", 6, "expected a license ID"},
+		{"(MIT OR ISC", 0, `unmatched "("`},
+		{"MIT)", 3, "expected an operator"},
+		{"MIT ISC", 4, "expected an operator"},
+		{"MIT or ISC", 4, `must be written as "OR"`},
+		{"GPL-2.0 +", 8, `"+" must immediately follow`},
+		{"(MIT OR ISC) WITH Classpath-exception-2.0", 13, "WITH must follow a single license ID"},
+		{"MIT WITH", 8, "license exception ID after WITH"},
+		{"LicenseRef-x+", 0, "cannot follow a LicenseRef"},
+		{"DocumentRef-x", 0, "must be followed by"},
+		{"MIT/ISC", 3, "unexpected character"},
+	} {
+		_, err := ParseExpression(tc.s)
+		pe, ok := err.(*ParseError)
+		if !ok {
+			t.Errorf("%q: expected ParseError, got %v", tc.s, err)
+			continue
+		}
+		if pe.Pos != tc.pos || !strings.Contains(pe.Msg, tc.msg) {
+			t.Errorf("%q: expected %q at %d, got %q at %d", tc.s, tc.msg, tc.pos, pe.Msg, pe.Pos)
+		}
+	}
+}
+
+func TestIsValidExpression(t *testing.T) {
+	for _, tc := range []struct {
+		s     string
+		valid bool
+	}{
+		{"NONE", true},
+		{"NOASSERTION", true},
+		{"MIT", true},
+		{"GPL-2.0+", true},
+		{"(MIT OR (ISC AND BSD-3-Clause))", true},
+		{"GPL-2.0-only WITH Classpath-exception-2.0", true},
+		{"LicenseRef-Proprietary OR MIT", true},
+		{"Unknown-1.0", false},
+		{"Classpath-exception-2.0", false},
+		{"GPL-2.0-only WITH MIT", false},
+		{"MIT OR NONE", false},
+		{"MIT OR", false},
+	} {
+		if v := IsValidExpression(tc.s, testCatalog); v != tc.valid {
+			t.Errorf("%q: expected valid to be %v, got %v", tc.s, tc.valid, v)
+		}
+	}
+}
+
+func TestGetLicenseIDs(t *testing.T) {
+	expr, err := ParseExpression("(MIT OR GPL-2.0+ WITH Classpath-exception-2.0) AND LicenseRef-x AND MIT")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	ids := GetLicenseIDs(expr)
+	if len(ids) != 2 || ids[0] != "GPL-2.0" || ids[1] != "MIT" {
+		t.Errorf("expected [GPL-2.0 MIT], got %v", ids)
+	}
+}
+
+func TestValidateExpressionErrors(t *testing.T) {
+	_, err := ValidateExpression("MIT AND Classpath-exception-2.0", testCatalog)
+	if err == nil || !strings.Contains(err.Error(), "can only be used after WITH") {
+		t.Errorf("expected exception outside WITH error, got %v", err)
+	}
+	_, err = ValidateExpression("MIT WITH ISC", testCatalog)
+	if err == nil || !strings.Contains(err.Error(), "is a license, not a license exception") {
+		t.Errorf("expected license after WITH error, got %v", err)
+	}
+}
+
+func TestParseJSONLicenses(t *testing.T) {
+	c := loadTestCatalog(t)
+	if c.LicenseListVersion != "3.5" {
+		t.Errorf("expected license list version 3.5, got %s", c.LicenseListVersion)
+	}
+	if !c.IsLicense("MIT") || c.IsLicense("Classpath-exception-2.0") {
+		t.Errorf("expected MIT and not Classpath-exception-2.0 in licenses")
+	}
+	if !c.IsException("Classpath-exception-2.0") || c.IsException("MIT") {
+		t.Errorf("expected Classpath-exception-2.0 and not MIT in exceptions")
+	}
+
+	mit := c.Licenses["MIT"]
+	if mit.Name != "MIT License" || !mit.IsOSIApproved || mit.IsDeprecated || len(mit.SeeAlso) == 0 {
+		t.Errorf("expected details of MIT, got %#v", mit)
+	}
+	if c.Licenses["WTFPL"].IsOSIApproved {
+		t.Errorf("expected WTFPL not to be OSI approved")
+	}
+	if !c.IsDeprecated("GPL-2.0") || !c.IsDeprecated("Nokia-Qt-exception-1.1") || c.IsDeprecated("GPL-2.0-only") || c.IsDeprecated("Unknown") {
+		t.Errorf("expected GPL-2.0 and Nokia-Qt-exception-1.1 only to be deprecated")
+	}
+}
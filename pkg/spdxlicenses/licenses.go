@@ -1,6 +1,6 @@
 // Package spdxlicenses does a simple parse of the SPDX
-// license-list-data JSON files, and creates a catalog of
-// valid license IDs.
+// license-list-data JSON files, creates a catalog of valid
+// license IDs, and parses and validates license expressions.
 // SPDX-License-Identifier: Apache-2.0
 // Copyright The Linux Foundation and npm-spdx contributors.
 package spdxlicenses
@@ -12,109 +12,144 @@ import (
 	"strings"
 )
 
-type licEntry struct {
-	LicenseID string `json:"licenseId"`
+// License describes one license on the SPDX License List.
+type License struct {
+	ID   string `json:"licenseId"`
+	Name string `json:"name"`
+	// IsOSIApproved is whether the license is approved by the Open
+	// Source Initiative.
+	IsOSIApproved bool `json:"isOsiApproved"`
+	// IsFSFLibre is whether the Free Software Foundation considers
+	// the license to be free; it is always false for versions of
+	// the list before 3.6, which don't record this.
+	IsFSFLibre   bool `json:"isFsfLibre"`
+	IsDeprecated bool `json:"isDeprecatedLicenseId"`
+	// SeeAlso lists URLs with more information about the license.
+	SeeAlso []string `json:"seeAlso"`
 }
 
-type licList struct {
-	Licenses []licEntry `json:"licenses"`
+// Exception describes one license exception on the SPDX License
+// List.
+type Exception struct {
+	ID           string   `json:"licenseExceptionId"`
+	Name         string   `json:"name"`
+	IsDeprecated bool     `json:"isDeprecatedLicenseId"`
+	SeeAlso      []string `json:"seeAlso"`
+}
+
+// Catalog contains the licenses and license exceptions from one
+// version of the SPDX License List.
+type Catalog struct {
+	// LicenseListVersion is the version of the SPDX License List,
+	// e.g. "3.5".
+	LicenseListVersion string
+	// Licenses maps license IDs to their Licenses.
+	Licenses map[string]*License
+	// Exceptions maps license exception IDs to their Exceptions.
+	Exceptions map[string]*Exception
 }
 
-type excEntry struct {
-	LicenseExceptionID string `json:"licenseExceptionId"`
+type licList struct {
+	LicenseListVersion string     `json:"licenseListVersion"`
+	Licenses           []*License `json:"licenses"`
 }
 
 type excList struct {
-	Exceptions []excEntry `json:"exceptions"`
+	LicenseListVersion string       `json:"licenseListVersion"`
+	Exceptions         []*Exception `json:"exceptions"`
 }
 
 // ParseJSONLicenses parses the SPDX license-list-data
-// licenses.json and exceptions.json files, and returns a
-// single set of strings (as a map) containing just the set of
-// valid license IDs.
-func ParseJSONLicenses(licensesPath, exceptionsPath string) (map[string]bool, error) {
-	// load licenses
-	ll := licList{}
-
-	js, err := ioutil.ReadFile(licensesPath)
+// licenses.json and exceptions.json files, and returns a Catalog
+// of the licenses and license exceptions they contain.
+func ParseJSONLicenses(licensesPath, exceptionsPath string) (*Catalog, error) {
+	ljs, err := ioutil.ReadFile(licensesPath)
 	if err != nil {
 		return nil, fmt.Errorf("error reading license list from %s: %v", licensesPath, err)
 	}
 
-	err = json.Unmarshal(js, &ll)
+	ejs, err := ioutil.ReadFile(exceptionsPath)
 	if err != nil {
-		return nil, fmt.Errorf("error unmarshalling from JSON: %v", err)
+		return nil, fmt.Errorf("error reading exceptions list from %s: %v", exceptionsPath, err)
 	}
 
-	// load exceptions
-	el := excList{}
+	return ParseJSONLicenseData(ljs, ejs)
+}
 
-	js, err = ioutil.ReadFile(exceptionsPath)
+// ParseJSONLicenseData takes byte slices with the contents of the
+// SPDX license-list-data licenses.json and exceptions.json files,
+// e.g. as embedded in a program, and returns a Catalog of the
+// licenses and license exceptions they contain.
+func ParseJSONLicenseData(licensesJSON, exceptionsJSON []byte) (*Catalog, error) {
+	// load licenses
+	ll := licList{}
+	err := json.Unmarshal(licensesJSON, &ll)
 	if err != nil {
-		return nil, fmt.Errorf("error reading exceptions list from %s: %v", exceptionsPath, err)
+		return nil, fmt.Errorf("error unmarshalling license list from JSON: %v", err)
 	}
 
-	err = json.Unmarshal(js, &el)
+	// load exceptions
+	el := excList{}
+	err = json.Unmarshal(exceptionsJSON, &el)
 	if err != nil {
-		return nil, fmt.Errorf("error unmarshalling from JSON: %v", err)
+		return nil, fmt.Errorf("error unmarshalling exceptions list from JSON: %v", err)
+	}
+
+	if ll.LicenseListVersion == "" || len(ll.Licenses) == 0 {
+		return nil, fmt.Errorf("license list contains no licenses")
+	}
+	if ll.LicenseListVersion != el.LicenseListVersion {
+		return nil, fmt.Errorf("license list version %s doesn't match exceptions list version %s", ll.LicenseListVersion, el.LicenseListVersion)
 	}
 
-	// and combine them
-	allLics := map[string]bool{}
+	// and build the catalog
+	c := &Catalog{
+		LicenseListVersion: ll.LicenseListVersion,
+		Licenses:           map[string]*License{},
+		Exceptions:         map[string]*Exception{},
+	}
 	for _, l := range ll.Licenses {
-		allLics[l.LicenseID] = true
+		c.Licenses[l.ID] = l
 	}
 	for _, e := range el.Exceptions {
-		allLics[e.LicenseExceptionID] = true
+		c.Exceptions[e.ID] = e
 	}
 
-	return allLics, nil
+	return c, nil
 }
 
-// IsValidExpression does rudimentary parsing to determine whether
-// a string is a valid SPDX license expression, given a particular
-// version of the SPDX license list. Note that this algorithm is
-// quick-and-dirty and probably needs more attention / expansion.
-func IsValidExpression(s string, listIDs map[string]bool) bool {
-	// NONE and NOASSERTION are valid
-	if s == "NONE" || s == "NOASSERTION" {
-		return true
-	}
-
-	// if there is only one LPAREN and one RPAREN, and they are
-	// at the start and end respectively, strip them off
-	if strings.Count(s, "(") == 1 && strings.HasPrefix(s, "(") &&
-		strings.Count(s, ")") == 1 && strings.HasSuffix(s, ")") {
-		s = strings.TrimPrefix(s, "(")
-		s = strings.TrimSuffix(s, ")")
-	}
-
-	// ignore all '+' characters, we'll treat them as valid
-	strings.ReplaceAll(s, "+", "")
+// IsLicense returns whether id is a license ID in the Catalog.
+func (c *Catalog) IsLicense(id string) bool {
+	_, ok := c.Licenses[id]
+	return ok
+}
 
-	// if there's ANDs or ORs, split them
-	// FIXME currently doing as case-sensitive splits, must be
-	// FIXME capitalized; this is not correct
-	andStrs := strings.SplitN(s, " AND ", -1)
+// IsException returns whether id is a license exception ID in
+// the Catalog.
+func (c *Catalog) IsException(id string) bool {
+	_, ok := c.Exceptions[id]
+	return ok
+}
 
-	// now split each of those by " OR "
-	strs := []string{}
-	for _, st := range andStrs {
-		orStrs := strings.SplitN(st, " OR ", -1)
-		for _, orSt := range orStrs {
-			strs = append(strs, orSt)
-		}
+// IsDeprecated returns whether id is a deprecated license ID or
+// license exception ID in the Catalog.
+func (c *Catalog) IsDeprecated(id string) bool {
+	if l, ok := c.Licenses[id]; ok {
+		return l.IsDeprecated
 	}
-
-	// finally, strs should now contain the 'processed' set of
-	// license IDs, so we can compare each to the license list
-	for _, st := range strs {
-		if _, ok := listIDs[st]; !ok {
-			return false
-		}
+	if e, ok := c.Exceptions[id]; ok {
+		return e.IsDeprecated
 	}
+	return false
+}
 
-	return true
+// IsValidExpression determines whether a string is a valid SPDX
+// license expression, given the licenses and license exceptions
+// in the Catalog. See ValidateExpression for the reason an
+// expression isn't valid.
+func IsValidExpression(s string, c *Catalog) bool {
+	_, err := ValidateExpression(s, c)
+	return err == nil
 }
 
 // ConvertToLicenseRef takes a license string and returns a
@@ -0,0 +1,194 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright The Linux Foundation and npm-spdx contributors.
+
+package spdxlicenses
+
+import (
+	"regexp"
+	"strings"
+)
+
+// licenseAliases maps common ways of writing a license in npm
+// package data, as returned by aliasKey, to its SPDX license ID.
+// Names that don't identify a single license, such as "BSD" or
+// "Public Domain", are deliberately left out.
+var licenseAliases = map[string]string{
+	"apache 2":                    "Apache-2.0",
+	"apache-2":                    "Apache-2.0",
+	"apache2":                     "Apache-2.0",
+	"apache v2":                   "Apache-2.0",
+	"apache license, version 2.0": "Apache-2.0",
+	"apache license version 2.0":  "Apache-2.0",
+	"apache, version 2.0":         "Apache-2.0",
+	"mit/x11":                     "MIT",
+	"x11/mit":                     "MIT",
+	"mit-license":                 "MIT",
+	"the mit license":             "MIT",
+	"expat":                       "MIT",
+	"bsd-2":                       "BSD-2-Clause",
+	"bsd 2-clause":                "BSD-2-Clause",
+	"simplified bsd":              "BSD-2-Clause",
+	"bsd-3":                       "BSD-3-Clause",
+	"bsd 3-clause":                "BSD-3-Clause",
+	"new bsd":                     "BSD-3-Clause",
+	"modified bsd":                "BSD-3-Clause",
+	"revised bsd":                 "BSD-3-Clause",
+	"gplv2":                       "GPL-2.0-only",
+	"gpl-2":                       "GPL-2.0-only",
+	"gpl v2":                      "GPL-2.0-only",
+	"gplv2+":                      "GPL-2.0-or-later",
+	"gpl-2+":                      "GPL-2.0-or-later",
+	"gplv3":                       "GPL-3.0-only",
+	"gpl-3":                       "GPL-3.0-only",
+	"gpl v3":                      "GPL-3.0-only",
+	"gplv3+":                      "GPL-3.0-or-later",
+	"gpl-3+":                      "GPL-3.0-or-later",
+	"lgplv2.1":                    "LGPL-2.1-only",
+	"lgplv2.1+":                   "LGPL-2.1-or-later",
+	"lgplv3":                      "LGPL-3.0-only",
+	"lgpl-3":                      "LGPL-3.0-only",
+	"lgplv3+":                     "LGPL-3.0-or-later",
+	"agplv3":                      "AGPL-3.0-only",
+	"agpl-3":                      "AGPL-3.0-only",
+	"mpl2":                        "MPL-2.0",
+	"mpl-2":                       "MPL-2.0",
+	"mpl 2":                       "MPL-2.0",
+	"cc0":                         "CC0-1.0",
+	"unlicence":                   "Unlicense",
+	"wtfpl-2.0":                   "WTFPL",
+	"wtfpl2":                      "WTFPL",
+}
+
+// aliasKey returns the lower-case form of s with its whitespace
+// collapsed, for looking up aliases and names.
+func aliasKey(s string) string {
+	return strings.ToLower(strings.Join(strings.Fields(s), " "))
+}
+
+// lowerCaseOperator matches operators that aren't in upper case,
+// as the SPDX specification requires.
+var lowerCaseOperator = regexp.MustCompile(`(?i)\s+(and|or|with)\s+`)
+
+// Normalizer converts license strings from package data to SPDX
+// license expressions, using the IDs and names in a Catalog.
+type Normalizer struct {
+	catalog *Catalog
+
+	// lower-case ID to ID
+	licenses   map[string]string
+	exceptions map[string]string
+	// aliasKey of the license's name to ID
+	names map[string]string
+}
+
+// NewNormalizer returns a Normalizer for the licenses and license
+// exceptions in the Catalog.
+func NewNormalizer(c *Catalog) *Normalizer {
+	n := &Normalizer{
+		catalog:    c,
+		licenses:   map[string]string{},
+		exceptions: map[string]string{},
+		names:      map[string]string{},
+	}
+	for id, l := range c.Licenses {
+		n.licenses[strings.ToLower(id)] = id
+		// deprecated IDs have the same names as the IDs that
+		// replaced them
+		if !l.IsDeprecated {
+			n.names[aliasKey(l.Name)] = id
+		}
+	}
+	for id := range c.Exceptions {
+		n.exceptions[strings.ToLower(id)] = id
+	}
+	return n
+}
+
+// Normalize returns s as a valid SPDX license expression, and
+// true; or else s unchanged, and false, if it can't be
+// normalized. Strings that are already valid are returned
+// unchanged. Otherwise, s is first looked up as a whole, and
+// then parsed as an expression and each license in it looked
+// up. License and exception IDs are matched regardless of case;
+// licenses are also matched against the aliases in
+// licenseAliases and the names on the SPDX License List.
+func (n *Normalizer) Normalize(s string) (string, bool) {
+	s = strings.TrimSpace(s)
+	if IsValidExpression(s, n.catalog) {
+		return s, true
+	}
+
+	// e.g. "Apache 2.0", "MIT/X11" or "The MIT License"
+	if id := n.lookupLicense(s); id != "" {
+		return id, true
+	}
+
+	// e.g. "(mit or Apache-2)"
+	fixed := lowerCaseOperator.ReplaceAllStringFunc(s, func(op string) string {
+		return " " + strings.ToUpper(strings.TrimSpace(op)) + " "
+	})
+	expr, err := ParseExpression(fixed)
+	if err != nil {
+		return s, false
+	}
+	n.normalizeExpression(expr)
+	if validate(expr, n.catalog) != nil {
+		return s, false
+	}
+	return expr.String(), true
+}
+
+// normalizeExpression replaces the IDs in expr, where possible,
+// with the IDs from the SPDX License List that they refer to.
+func (n *Normalizer) normalizeExpression(expr Expression) {
+	switch e := expr.(type) {
+	case *SimpleExpression:
+		n.normalizeLicense(e)
+	case *WithExpression:
+		n.normalizeLicense(e.License)
+		if id, ok := n.exceptions[strings.ToLower(e.Exception)]; ok {
+			e.Exception = id
+		}
+	case *CompoundExpression:
+		n.normalizeExpression(e.Left)
+		n.normalizeExpression(e.Right)
+	}
+}
+
+func (n *Normalizer) normalizeLicense(e *SimpleExpression) {
+	if e.IsLicenseRef() || n.catalog.IsLicense(e.ID) {
+		return
+	}
+	// an alias may already include the "+", e.g. "GPLv2+"
+	if e.OrLater {
+		if id := n.lookupLicense(e.ID + "+"); id != "" {
+			e.ID = id
+			e.OrLater = false
+			return
+		}
+	}
+	if id := n.lookupLicense(e.ID); id != "" {
+		e.ID = id
+	}
+}
+
+// lookupLicense returns the ID of the license on the SPDX License
+// List that s refers to, if any: matching s, or s with spaces
+// replaced by hyphens, to its IDs regardless of case; or else
+// matching an alias or a license name.
+func (n *Normalizer) lookupLicense(s string) string {
+	key := aliasKey(s)
+	if id, ok := n.licenses[key]; ok {
+		return id
+	}
+	if id, ok := n.licenses[strings.ReplaceAll(key, " ", "-")]; ok {
+		return id
+	}
+	if id, ok := licenseAliases[key]; ok && n.catalog.IsLicense(id) {
+		return id
+	}
+	if id, ok := n.names[key]; ok {
+		return id
+	}
+	return ""
+}
@@ -0,0 +1,47 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright The Linux Foundation and npm-spdx contributors.
+
+package spdxlicenses
+
+import "testing"
+
+func TestNormalize(t *testing.T) {
+	n := NewNormalizer(loadTestCatalog(t))
+
+	for _, tc := range []struct {
+		s        string
+		expected string
+		ok       bool
+	}{
+		// already valid, so unchanged
+		{"MIT", "MIT", true},
+		{"(MIT OR Apache-2.0)", "(MIT OR Apache-2.0)", true},
+		{"GPL-2.0+", "GPL-2.0+", true},
+		// case-insensitive IDs and operators
+		{"mit", "MIT", true},
+		{"(mit or apache-2.0)", "MIT OR Apache-2.0", true},
+		{"GPL-2.0-only with classpath-exception-2.0", "GPL-2.0-only WITH Classpath-exception-2.0", true},
+		// aliases
+		{"Apache 2.0", "Apache-2.0", true},
+		{"MIT/X11", "MIT", true},
+		{"(MIT OR Apache-2)", "MIT OR Apache-2.0", true},
+		{"GPLv3", "GPL-3.0-only", true},
+		{"GPLv2+", "GPL-2.0-or-later", true},
+		{"Apache2 AND GPLv3+", "Apache-2.0 AND GPL-3.0-or-later", true},
+		// license list names
+		{"Apache License 2.0", "Apache-2.0", true},
+		{"  mozilla public license 2.0 ", "MPL-2.0", true},
+		{"GNU General Public License v2.0 only", "GPL-2.0-only", true},
+		// ambiguous or unknown, so unchanged
+		{"BSD", "BSD", false},
+		{"Public Domain", "Public Domain", false},
+		{"UNLICENSED", "UNLICENSED", false},
+		{"MIT OR Unknown", "MIT OR Unknown", false},
+		{"SEE LICENSE IN LICENSE.md", "SEE LICENSE IN LICENSE.md", false},
+	} {
+		lic, ok := n.Normalize(tc.s)
+		if lic != tc.expected || ok != tc.ok {
+			t.Errorf("%q: expected (%q, %v), got (%q, %v)", tc.s, tc.expected, tc.ok, lic, ok)
+		}
+	}
+}
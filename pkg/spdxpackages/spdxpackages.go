@@ -6,7 +6,7 @@ package spdxpackages
 
 import (
 	"fmt"
-	"log"
+	"strings"
 	"time"
 
 	"github.com/spdx/tools-golang/spdx"
@@ -14,22 +14,33 @@ import (
 	"github.com/swinslow/npm-spdx/pkg/spdxlicenses"
 )
 
+// BuildOptions contains the optional settings for
+// BuildSPDXDocument.
+type BuildOptions struct {
+	// UpgradeDeprecated replaces deprecated license IDs with their
+	// current equivalents, e.g. "GPL-2.0" with "GPL-2.0-only".
+	UpgradeDeprecated bool
+}
+
 // BuildSPDXDocument takes the processed license and dependency data
 // from a previously-generated results.json file, and returns an SPDX
 // document based on them, together with the relevant relationship details.
-func BuildSPDXDocument(dr *npm.DependencyResults) (*spdx.Document2_1, error) {
-	// load valid license IDs
-	llPath := "data/licenses.json"
-	elPath := "data/exceptions.json"
-	allLics, err := spdxlicenses.ParseJSONLicenses(llPath, elPath)
-	if err != nil {
-		log.Fatalf("error loading SPDX license IDs from %s, %s: %v", llPath, elPath, err)
+// Licenses are checked against the SPDX License List in catalog. If
+// opts is nil, the default options are used.
+func BuildSPDXDocument(dr *npm.DependencyResults, catalog *spdxlicenses.Catalog, opts *BuildOptions) (*spdx.Document2_1, error) {
+	if catalog == nil {
+		return nil, fmt.Errorf("no SPDX license list provided")
 	}
+	if opts == nil {
+		opts = &BuildOptions{}
+	}
+
+	normalizer := spdxlicenses.NewNormalizer(catalog)
 
 	// build creation info section
 	// FIXME namespace should be unique, see SPDX 2.1 spec section 2.5
 	namespace := fmt.Sprintf("https://spdx.org/spdxdocs/%s-%s", dr.Name, dr.Version)
-	ci := buildCreationInfoSection(dr.Name, namespace)
+	ci := buildCreationInfoSection(dr.Name, namespace, catalog.LicenseListVersion)
 
 	// build collection of package sections, looking to results for
 	// what we actually installed; also build relationship sections
@@ -37,90 +48,163 @@ func BuildSPDXDocument(dr *npm.DependencyResults) (*spdx.Document2_1, error) {
 	pkgs := []*spdx.Package2_1{}
 	rlns := []*spdx.Relationship2_1{}
 	ols := []*spdx.OtherLicense2_1{}
+	anns := []*spdx.Annotation2_1{}
 
 	// also track which converted "other licenses" we have created
 	convertedLics := map[string]bool{}
 
-	// build entry for main package
-	lic := dr.License
-	if lic == "" {
-		lic = "NOASSERTION"
-	}
-	// make sure the main package license is valid too!
-	if !spdxlicenses.IsValidExpression(lic, allLics) {
-		lic = spdxlicenses.ConvertToLicenseRef(lic)
-		convertedLics[lic] = true
-		ol := buildOtherLicense(lic, dr.License)
-		ols = append(ols, ol)
-	}
+	// convertLicense returns the license expression to use for a
+	// package, normalizing it to a valid SPDX expression if
+	// possible (and upgrading any deprecated IDs, if requested), or
+	// else converting it to a LicenseRef and adding a new
+	// OtherLicense entry. licText is the text of the
+	// file referred to by a "SEE LICENSE IN <file>" declaration,
+	// if it was retrieved.
+	convertLicense := func(pkgName, pkgVer, origLic, licText string) string {
+		if origLic == "" {
+			return "NOASSERTION"
+		}
 
-	mainPkg := buildPackageSection(dr.Name, dr.Version, "NOASSERTION", lic)
-	pkgs = append(pkgs, mainPkg)
+		// npm's marker for proprietary packages
+		if npm.IsUnlicensed(origLic) {
+			if !convertedLics[unlicensedRef] {
+				convertedLics[unlicensedRef] = true
+				ols = append(ols, buildUnlicensedOtherLicense())
+			}
+			return unlicensedRef
+		}
 
-	// also add DESCRIBES relationship for main package
-	mainRln := &spdx.Relationship2_1{
-		RefA:         "SPDXRef-DOCUMENT",
-		RefB:         mainPkg.PackageSPDXIdentifier,
-		Relationship: "DESCRIBES",
-	}
-	rlns = append(rlns, mainRln)
+		licFile, isFile := npm.GetSeeLicenseFile(origLic)
+		if !isFile {
+			if norm, ok := normalizer.Normalize(origLic); ok {
+				if opts.UpgradeDeprecated {
+					norm, _ = spdxlicenses.UpgradeDeprecatedExpression(norm, catalog)
+				}
+				return norm
+			}
+		}
 
-	for _, rp := range dr.Results {
-		// convert license if needed
-		pkgLic := rp.License
-		if !spdxlicenses.IsValidExpression(pkgLic, allLics) {
-			// first see if we've already got an OtherLicense entry
-			// for this one
-			foundMatch := false
+		// licenses in a file get their own LicenseRef, with the
+		// file's text if we have it
+		extractedText := origLic
+		licName := origLic
+		if isFile {
+			licName = licFile
+			if licText != "" {
+				extractedText = licText
+			}
+		}
+
+		pkgLic := origLic
+		// first see if we've already got an OtherLicense entry
+		// for this one; but files we couldn't retrieve could
+		// have any text, so don't merge those
+		foundMatch := false
+		if !isFile || licText != "" {
 			for _, ol := range ols {
-				if ol.ExtractedText == pkgLic {
+				if ol.ExtractedText == extractedText {
 					pkgLic = ol.LicenseIdentifier
 					foundMatch = true
 				}
 			}
+		}
 
-			if !foundMatch {
-				// convert it to LicenseRef format
+		if !foundMatch {
+			// convert it to LicenseRef format
+			if isFile {
+				pkgLic = spdxlicenses.ConvertToLicenseRef(fmt.Sprintf("%s-%s-%s", pkgName, pkgVer, licFile))
+			} else {
 				pkgLic = spdxlicenses.ConvertToLicenseRef(pkgLic)
+			}
 
-				// and now make sure that we find a free ID
-				if _, ok := convertedLics[pkgLic]; ok {
-					var newConverted string
-					for i := 1; ; i++ {
-						newConverted = fmt.Sprintf("%s-%d", pkgLic, i)
-						if _, ok := convertedLics[newConverted]; !ok {
-							break
-						}
+			// and now make sure that we find a free ID
+			if _, ok := convertedLics[pkgLic]; ok {
+				var newConverted string
+				for i := 1; ; i++ {
+					newConverted = fmt.Sprintf("%s-%d", pkgLic, i)
+					if _, ok := convertedLics[newConverted]; !ok {
+						break
 					}
-					pkgLic = newConverted
 				}
+				pkgLic = newConverted
+			}
 
-				// and now add it to the list and build other license section
-				convertedLics[pkgLic] = true
-				ol := buildOtherLicense(pkgLic, rp.License)
-				ols = append(ols, ol)
+			// and now add it to the list and build other license section
+			convertedLics[pkgLic] = true
+			var ol *spdx.OtherLicense2_1
+			if isFile {
+				ol = buildLicenseFileOtherLicense(pkgLic, pkgName, pkgVer, origLic, licName, extractedText, licText != "")
+			} else {
+				ol = buildOtherLicense(pkgLic, origLic)
 			}
+			ols = append(ols, ol)
+		}
+		return pkgLic
+	}
+
+	// build entry for main package
+	mainLic := convertLicense(dr.Name, dr.Version, dr.License, "")
+	mainPkg := buildPackageSection(dr.Name, dr.Version, "NOASSERTION", mainLic)
+	mainPkg.PackageLicenseComments = buildNormalizedLicenseComments(dr.License, mainLic)
+	pkgs = append(pkgs, mainPkg)
+
+	// also add DESCRIBES relationship for main package
+	mainRln := &spdx.Relationship2_1{
+		RefA:         "SPDXRef-DOCUMENT",
+		RefB:         mainPkg.PackageSPDXIdentifier,
+		Relationship: "DESCRIBES",
+	}
+	rlns = append(rlns, mainRln)
 
+	for _, rp := range dr.Results {
+		// convert license if needed; if the package's data couldn't
+		// be retrieved, explain why there's no license
+		var pkgLic string
+		if rp.Error != "" {
+			pkgLic = "NOASSERTION"
+			ann := buildFailureAnnotation(rp.Name, rp.Version, rp.Error, ci.Created)
+			anns = append(anns, ann)
+		} else {
+			pkgLic = convertLicense(rp.Name, rp.Version, rp.License, rp.LicenseText)
 		}
 
 		// FIXME for now, don't fill in PackageDownloadLocation
 		pkg := buildPackageSection(rp.Name, rp.Version, "NOASSERTION", pkgLic)
+		origLic := rp.License
+		if rp.OriginalLicense != "" {
+			origLic = rp.OriginalLicense
+		}
+		pkg.PackageLicenseComments = buildNormalizedLicenseComments(origLic, pkgLic)
 		pkgs = append(pkgs, pkg)
 
-		// build relationships
+		// build relationships; bundled dependencies are contained
+		// in this package rather than depended upon
+		bundled := map[string]bool{}
+		for _, depName := range rp.BundledDependencies {
+			bundled[depName] = true
+		}
 		for depName := range rp.Dependencies {
-			// get the dependency version that was actually installed
-			if depRp, ok := dr.Results[depName]; ok {
-				rln := buildDependencyRelationship(rp.Name, rp.Version, depName, depRp.Version)
-				rlns = append(rlns, rln)
+			for _, inst := range getInstalledPackages(dr, rp, depName) {
+				if bundled[depName] {
+					rln := buildContainsRelationship(rp.Name, rp.Version, inst.name, inst.ver)
+					rlns = append(rlns, rln)
+				} else {
+					rln := buildDependencyRelationship(rp.Name, rp.Version, inst.name, inst.ver)
+					rlns = append(rlns, rln)
+				}
 			}
 		}
 
 		// also add relationship if it's a direct dependency (main or dev)
 		// of the main package
 		if rp.IsDirectDep {
-			rln := buildDependencyRelationship(dr.Name, dr.Version, rp.Name, rp.Version)
-			rlns = append(rlns, rln)
+			if isRootBundled(dr, rp.Name) {
+				rln := buildContainsRelationship(dr.Name, dr.Version, rp.Name, rp.Version)
+				rlns = append(rlns, rln)
+			} else {
+				rln := buildDependencyRelationship(dr.Name, dr.Version, rp.Name, rp.Version)
+				rlns = append(rlns, rln)
+			}
 		}
 		if rp.IsDirectDevDep {
 			rln := buildDevDependencyRelationship(dr.Name, dr.Version, rp.Name, rp.Version)
@@ -128,16 +212,102 @@ func BuildSPDXDocument(dr *npm.DependencyResults) (*spdx.Document2_1, error) {
 		}
 	}
 
+	// build entries for workspace packages, which are contained in
+	// the main package and have their own direct dependencies
+	wsVersions := map[string]string{}
+	for _, ws := range dr.Workspaces {
+		wsVersions[ws.Name] = ws.Version
+	}
+	for _, ws := range dr.Workspaces {
+		wsLic := convertLicense(ws.Name, ws.Version, ws.License, "")
+		pkg := buildPackageSection(ws.Name, ws.Version, "NOASSERTION", wsLic)
+		pkg.PackageLicenseComments = buildNormalizedLicenseComments(ws.License, wsLic)
+		pkgs = append(pkgs, pkg)
+
+		rln := buildContainsRelationship(dr.Name, dr.Version, ws.Name, ws.Version)
+		rlns = append(rlns, rln)
+
+		for depName := range ws.Dependencies {
+			if inst, ok := getWorkspaceInstalledPackage(ws, depName, wsVersions); ok {
+				rln := buildDependencyRelationship(ws.Name, ws.Version, inst.name, inst.ver)
+				rlns = append(rlns, rln)
+			}
+		}
+		for depName := range ws.DevDependencies {
+			if inst, ok := getWorkspaceInstalledPackage(ws, depName, wsVersions); ok {
+				rln := buildDevDependencyRelationship(ws.Name, ws.Version, inst.name, inst.ver)
+				rlns = append(rlns, rln)
+			}
+		}
+	}
+
 	doc := &spdx.Document2_1{
 		CreationInfo:  ci,
 		Packages:      pkgs,
 		Relationships: rlns,
 		OtherLicenses: ols,
+		Annotations:   anns,
 	}
 
 	return doc, nil
 }
 
+// installedPackage is the name and version of a package that was
+// installed for a dependency; the name differs from the
+// dependency's for aliases.
+type installedPackage struct {
+	name string
+	ver  string
+}
+
+// getInstalledPackages returns the package version(s) that were
+// actually installed for dependency depName of package rp. Copies
+// of rp at different locations may have had it resolved to
+// different versions.
+func getInstalledPackages(dr *npm.DependencyResults, rp *npm.Dependency, depName string) []installedPackage {
+	depVer, ok := rp.InstalledDependencies[depName]
+	if !ok {
+		// older results files are keyed by name alone
+		if depRp, ok := dr.Results[depName]; ok {
+			return []installedPackage{{depName, depRp.Version}}
+		}
+		return nil
+	}
+
+	insts := []installedPackage{}
+	for _, v := range append([]string{depVer}, rp.OtherInstalledDependencies[depName]...) {
+		name, ver := npm.ParseInstalledVersion(depName, v)
+		insts = append(insts, installedPackage{name, ver})
+	}
+	return insts
+}
+
+// getWorkspaceInstalledPackage returns the package version that
+// was installed for dependency depName of workspace package ws. If
+// depName is another workspace package, its local version is used.
+func getWorkspaceInstalledPackage(ws *npm.Workspace, depName string, wsVersions map[string]string) (installedPackage, bool) {
+	if depVer, ok := wsVersions[depName]; ok {
+		return installedPackage{depName, depVer}, true
+	}
+	v, ok := ws.InstalledDependencies[depName]
+	if !ok {
+		return installedPackage{}, false
+	}
+	name, ver := npm.ParseInstalledVersion(depName, v)
+	return installedPackage{name, ver}, true
+}
+
+// isRootBundled returns whether the main package bundles the
+// named dependency.
+func isRootBundled(dr *npm.DependencyResults, depName string) bool {
+	for _, name := range dr.BundledDependencies {
+		if name == depName {
+			return true
+		}
+	}
+	return false
+}
+
 func getSPDXID(pkg string, ver string) string {
 	return fmt.Sprintf("SPDXRef-%s-%s", pkg, ver)
 }
@@ -146,7 +316,7 @@ func getNpmURL(pkg string, ver string) string {
 	return fmt.Sprintf("https://www.npmjs.com/package/%s/v/%s", pkg, ver)
 }
 
-func buildCreationInfoSection(mainPackageName string, namespace string) *spdx.CreationInfo2_1 {
+func buildCreationInfoSection(mainPackageName string, namespace string, licenseListVersion string) *spdx.CreationInfo2_1 {
 	// get current time in UTC
 	location, _ := time.LoadLocation("UTC")
 	locationTime := time.Now().In(location)
@@ -158,7 +328,7 @@ func buildCreationInfoSection(mainPackageName string, namespace string) *spdx.Cr
 		SPDXIdentifier:     "SPDXRef-DOCUMENT",
 		DocumentName:       mainPackageName,
 		DocumentNamespace:  namespace,
-		LicenseListVersion: "3.5",
+		LicenseListVersion: licenseListVersion,
 		CreatorTools:       []string{"github.com/swinslow/npm-spdx"},
 		Created:            created,
 	}
@@ -204,6 +374,18 @@ func buildDependencyRelationship(pkgName, pkgVer, depName, depVer string) *spdx.
 	return rln
 }
 
+func buildContainsRelationship(pkgName, pkgVer, depName, depVer string) *spdx.Relationship2_1 {
+	pkgID := getSPDXID(pkgName, pkgVer)
+	depID := getSPDXID(depName, depVer)
+	rln := &spdx.Relationship2_1{
+		RefA:         pkgID,
+		RefB:         depID,
+		Relationship: "CONTAINS",
+	}
+
+	return rln
+}
+
 func buildDevDependencyRelationship(pkgName, pkgVer, depName, depVer string) *spdx.Relationship2_1 {
 	pkgID := getSPDXID(pkgName, pkgVer)
 	depID := getSPDXID(depName, depVer)
@@ -216,6 +398,50 @@ func buildDevDependencyRelationship(pkgName, pkgVer, depName, depVer string) *sp
 	return rln
 }
 
+// unlicensedRef is the LicenseRef used for packages declared as
+// "UNLICENSED", i.e. proprietary.
+const unlicensedRef = "LicenseRef-UNLICENSED"
+
+func buildUnlicensedOtherLicense() *spdx.OtherLicense2_1 {
+	ol := &spdx.OtherLicense2_1{
+		LicenseIdentifier: unlicensedRef,
+		ExtractedText:     "UNLICENSED",
+		LicenseName:       "UNLICENSED (proprietary)",
+		LicenseComment:    "Represents npm's 'UNLICENSED' declaration, meaning that the package's authors do not grant others the right to use it under any terms",
+	}
+
+	return ol
+}
+
+func buildLicenseFileOtherLicense(converted, pkgName, pkgVer, orig, file, text string, haveText bool) *spdx.OtherLicense2_1 {
+	var cmt string
+	if haveText {
+		cmt = fmt.Sprintf("Text of %s from the published package %s@%s, as referred to by its license declaration '%s'", file, pkgName, pkgVer, orig)
+	} else {
+		cmt = fmt.Sprintf("Represents the license declaration '%s' of %s@%s; the text of %s could not be retrieved", orig, pkgName, pkgVer, file)
+	}
+
+	ol := &spdx.OtherLicense2_1{
+		LicenseIdentifier: converted,
+		ExtractedText:     text,
+		LicenseName:       file,
+		LicenseComment:    cmt,
+	}
+
+	return ol
+}
+
+// buildNormalizedLicenseComments returns a comment recording the
+// license as originally declared, if licDeclared is a normalized
+// form of it; LicenseRefs are described by their OtherLicense
+// entries instead.
+func buildNormalizedLicenseComments(orig string, licDeclared string) string {
+	if orig == "" || orig == licDeclared || licDeclared == "NOASSERTION" || strings.HasPrefix(licDeclared, "LicenseRef-") {
+		return ""
+	}
+	return fmt.Sprintf("Declared license '%s' was normalized to the SPDX license expression '%s'", orig, licDeclared)
+}
+
 func buildOtherLicense(converted, orig string) *spdx.OtherLicense2_1 {
 	cmt := fmt.Sprintf("Represents the license expression '%s' which is not on the SPDX License List", orig)
 
@@ -228,3 +454,18 @@ func buildOtherLicense(converted, orig string) *spdx.OtherLicense2_1 {
 
 	return ol
 }
+
+func buildFailureAnnotation(pkgName, pkgVer, reason, created string) *spdx.Annotation2_1 {
+	cmt := fmt.Sprintf("License information could not be retrieved for this package: %s", reason)
+
+	ann := &spdx.Annotation2_1{
+		Annotator:                "github.com/swinslow/npm-spdx",
+		AnnotatorType:            "Tool",
+		AnnotationDate:           created,
+		AnnotationType:           "OTHER",
+		AnnotationSPDXIdentifier: getSPDXID(pkgName, pkgVer),
+		AnnotationComment:        cmt,
+	}
+
+	return ann
+}
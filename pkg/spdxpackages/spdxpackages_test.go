@@ -0,0 +1,220 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright The Linux Foundation and npm-spdx contributors.
+
+package spdxpackages
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/spdx/tools-golang/spdx"
+	"github.com/swinslow/npm-spdx/pkg/npm"
+	"github.com/swinslow/npm-spdx/pkg/spdxlicenses"
+)
+
+func TestBuildSPDXDocumentLicenses(t *testing.T) {
+	catalog, err := spdxlicenses.ParseJSONLicenses("../../data/licenses.json", "../../data/exceptions.json")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	dr := &npm.DependencyResults{
+		Name:    "app",
+		Version: "1.0.0",
+		License: "mit",
+		Results: map[string]*npm.Dependency{
+			"a@1.0.0": {Name: "a", Version: "1.0.0", License: "GPL-2.0+"},
+			"b@1.0.0": {Name: "b", Version: "1.0.0", License: "MIT", OriginalLicense: "MIT/X11"},
+			"c@1.0.0": {Name: "c", Version: "1.0.0", License: "UNLICENSED"},
+			"d@1.0.0": {Name: "d", Version: "1.0.0", License: "SEE LICENSE IN EULA", LicenseFile: "EULA", LicenseText: "EULA text"},
+			"e@1.0.0": {Name: "e", Version: "1.0.0", License: "Public Domain"},
+		},
+	}
+	doc, err := BuildSPDXDocument(dr, catalog, &BuildOptions{UpgradeDeprecated: true})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if doc.CreationInfo.LicenseListVersion != "3.5" {
+		t.Errorf("expected license list version 3.5, got %s", doc.CreationInfo.LicenseListVersion)
+	}
+
+	expected := map[string]struct {
+		declared string
+		comments string
+	}{
+		"app": {"MIT", "Declared license 'mit' was normalized to the SPDX license expression 'MIT'"},
+		"a":   {"GPL-2.0-or-later", "Declared license 'GPL-2.0+' was normalized to the SPDX license expression 'GPL-2.0-or-later'"},
+		"b":   {"MIT", "Declared license 'MIT/X11' was normalized to the SPDX license expression 'MIT'"},
+		"c":   {"LicenseRef-UNLICENSED", ""},
+		"d":   {"LicenseRef-d-1.0.0-EULA", ""},
+		"e":   {"LicenseRef-Public-Domain", ""},
+	}
+	if len(doc.Packages) != len(expected) {
+		t.Fatalf("expected %d packages, got %d", len(expected), len(doc.Packages))
+	}
+	for _, pkg := range doc.Packages {
+		exp := expected[pkg.PackageName]
+		if pkg.PackageLicenseDeclared != exp.declared || pkg.PackageLicenseComments != exp.comments {
+			t.Errorf("%s: expected (%q, %q), got (%q, %q)", pkg.PackageName, exp.declared, exp.comments, pkg.PackageLicenseDeclared, pkg.PackageLicenseComments)
+		}
+	}
+
+	texts := map[string]string{}
+	for _, ol := range doc.OtherLicenses {
+		texts[ol.LicenseIdentifier] = ol.ExtractedText
+	}
+	if len(texts) != 3 || texts["LicenseRef-d-1.0.0-EULA"] != "EULA text" || texts["LicenseRef-Public-Domain"] != "Public Domain" {
+		t.Errorf("expected 3 other licenses with extracted text, got %v", texts)
+	}
+}
+
+func TestBuildSPDXDocumentNoCatalog(t *testing.T) {
+	_, err := BuildSPDXDocument(&npm.DependencyResults{}, nil, nil)
+	if err == nil {
+		t.Errorf("expected error without a license list, got nil")
+	}
+}
+
+// getRelationships returns the document's relationships in the
+// form "RefA RELATIONSHIP RefB".
+func getRelationships(doc *spdx.Document2_1) map[string]bool {
+	rlns := map[string]bool{}
+	for _, rln := range doc.Relationships {
+		rlns[rln.RefA+" "+rln.Relationship+" "+rln.RefB] = true
+	}
+	return rlns
+}
+
+func TestBuildSPDXDocumentBundled(t *testing.T) {
+	catalog, err := spdxlicenses.ParseJSONLicenses("../../data/licenses.json", "../../data/exceptions.json")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	dr := &npm.DependencyResults{
+		Name:                "app",
+		Version:             "1.0.0",
+		BundledDependencies: []string{"a"},
+		Results: map[string]*npm.Dependency{
+			"a@1.0.0": {Name: "a", Version: "1.0.0", License: "MIT", IsDirectDep: true},
+			"c@1.0.0": {Name: "c", Version: "1.0.0", License: "MIT", IsDirectDep: true,
+				Dependencies:          map[string]string{"d": "^1.0.0", "e": "^1.0.0"},
+				InstalledDependencies: map[string]string{"d": "1.0.0", "e": "1.0.0"},
+				BundledDependencies:   []string{"d"}},
+			"d@1.0.0": {Name: "d", Version: "1.0.0", License: "MIT"},
+			"e@1.0.0": {Name: "e", Version: "1.0.0", License: "MIT"},
+		},
+	}
+	doc, err := BuildSPDXDocument(dr, catalog, nil)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	rlns := getRelationships(doc)
+	for _, tc := range []struct {
+		rln      string
+		expected bool
+	}{
+		{"SPDXRef-app-1.0.0 CONTAINS SPDXRef-a-1.0.0", true},
+		{"SPDXRef-a-1.0.0 PREREQUISITE_FOR SPDXRef-app-1.0.0", false},
+		{"SPDXRef-c-1.0.0 PREREQUISITE_FOR SPDXRef-app-1.0.0", true},
+		{"SPDXRef-app-1.0.0 CONTAINS SPDXRef-c-1.0.0", false},
+		{"SPDXRef-c-1.0.0 CONTAINS SPDXRef-d-1.0.0", true},
+		{"SPDXRef-d-1.0.0 PREREQUISITE_FOR SPDXRef-c-1.0.0", false},
+		{"SPDXRef-e-1.0.0 PREREQUISITE_FOR SPDXRef-c-1.0.0", true},
+	} {
+		if rlns[tc.rln] != tc.expected {
+			t.Errorf("%q: expected present %v, got %v", tc.rln, tc.expected, rlns[tc.rln])
+		}
+	}
+}
+
+func TestBuildSPDXDocumentWorkspaces(t *testing.T) {
+	catalog, err := spdxlicenses.ParseJSONLicenses("../../data/licenses.json", "../../data/exceptions.json")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	dr := &npm.DependencyResults{
+		Name:    "app",
+		Version: "1.0.0",
+		Workspaces: []*npm.Workspace{
+			{Name: "a", Version: "1.0.0", License: "MIT", Path: "packages/a",
+				Dependencies:          map[string]string{"b": "workspace:*", "foo": "npm:ms@^2.0.0"},
+				DevDependencies:       map[string]string{"debug": "^4.3.0"},
+				InstalledDependencies: map[string]string{"foo": "npm:ms@2.0.0", "debug": "4.3.4"}},
+			{Name: "b", Version: "2.0.0", License: "ISC", Path: "packages/b"},
+		},
+		Results: map[string]*npm.Dependency{
+			"ms@2.0.0":    {Name: "ms", Version: "2.0.0", License: "MIT"},
+			"debug@4.3.4": {Name: "debug", Version: "4.3.4", License: "MIT"},
+		},
+	}
+	doc, err := BuildSPDXDocument(dr, catalog, nil)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	declared := map[string]string{}
+	for _, pkg := range doc.Packages {
+		declared[pkg.PackageName] = pkg.PackageLicenseDeclared
+	}
+	if declared["a"] != "MIT" || declared["b"] != "ISC" {
+		t.Errorf("expected workspace packages with their own licenses, got %v", declared)
+	}
+
+	rlns := getRelationships(doc)
+	for _, rln := range []string{
+		"SPDXRef-app-1.0.0 CONTAINS SPDXRef-a-1.0.0",
+		"SPDXRef-app-1.0.0 CONTAINS SPDXRef-b-2.0.0",
+		"SPDXRef-b-2.0.0 PREREQUISITE_FOR SPDXRef-a-1.0.0",
+		"SPDXRef-ms-2.0.0 PREREQUISITE_FOR SPDXRef-a-1.0.0",
+		"SPDXRef-debug-4.3.4 BUILD_TOOL_OF SPDXRef-a-1.0.0",
+	} {
+		if !rlns[rln] {
+			t.Errorf("expected relationship %q", rln)
+		}
+	}
+	if len(doc.Relationships) != 6 {
+		t.Errorf("expected 6 relationships, got %d", len(doc.Relationships))
+	}
+}
+
+func TestBuildSPDXDocumentFailures(t *testing.T) {
+	catalog, err := spdxlicenses.ParseJSONLicenses("../../data/licenses.json", "../../data/exceptions.json")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	dr := &npm.DependencyResults{
+		Name:    "app",
+		Version: "1.0.0",
+		Results: map[string]*npm.Dependency{
+			"a@1.0.0": {Name: "a", Version: "1.0.0", License: "MIT"},
+			"b@1.0.0": {Name: "b", Version: "1.0.0", License: "NOASSERTION", Error: "while getting b/1.0.0: not found"},
+		},
+	}
+	doc, err := BuildSPDXDocument(dr, catalog, nil)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	for _, pkg := range doc.Packages {
+		if pkg.PackageName == "b" && pkg.PackageLicenseDeclared != "NOASSERTION" {
+			t.Errorf("expected NOASSERTION for b, got %q", pkg.PackageLicenseDeclared)
+		}
+	}
+	if len(doc.Annotations) != 1 {
+		t.Fatalf("expected 1 annotation, got %d", len(doc.Annotations))
+	}
+	ann := doc.Annotations[0]
+	if ann.AnnotationSPDXIdentifier != "SPDXRef-b-1.0.0" || ann.AnnotationType != "OTHER" {
+		t.Errorf("expected OTHER annotation for b, got %+v", ann)
+	}
+	if !strings.HasSuffix(ann.AnnotationComment, ": while getting b/1.0.0: not found") {
+		t.Errorf("expected annotation to give the reason, got %q", ann.AnnotationComment)
+	}
+	if ann.AnnotationDate != doc.CreationInfo.Created {
+		t.Errorf("expected annotation date %q, got %q", doc.CreationInfo.Created, ann.AnnotationDate)
+	}
+}
@@ -5,8 +5,11 @@ package main
 
 import (
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"log"
+	"sort"
+	"strings"
 
 	"github.com/swinslow/npm-spdx/pkg/npm"
 	"github.com/swinslow/npm-spdx/pkg/spdxlicenses"
@@ -17,22 +20,29 @@ type packageVersion struct {
 	Ver            string `json:"version"`
 	IsDirectDep    bool   `json:"isDirectDep,omitempty"`
 	IsDirectDevDep bool   `json:"isDirectDevDep,omitempty"`
+	Error          string `json:"error,omitempty"`
+}
+
+// licInfo describes a license from the SPDX License List that is
+// used in a license expression.
+type licInfo struct {
+	LicID         string `json:"id"`
+	Name          string `json:"name"`
+	IsOSIApproved bool   `json:"osiApproved"`
+	IsFSFLibre    bool   `json:"fsfLibre,omitempty"`
 }
 
 type licEntry struct {
-	LicID  string           `json:"id"`
-	IsSPDX bool             `json:"valid"`
-	Deps   []packageVersion `json:"dependencies"`
+	LicID      string           `json:"id"`
+	IsSPDX     bool             `json:"valid"`
+	Licenses   []licInfo        `json:"licenses,omitempty"`
+	Deprecated []string         `json:"deprecated,omitempty"`
+	Deps       []packageVersion `json:"dependencies"`
 }
 
-func report(jsResults string, jsReportOutput string) {
-	// load valid license IDs
-	llPath := "data/licenses.json"
-	elPath := "data/exceptions.json"
-	allLics, err := spdxlicenses.ParseJSONLicenses(llPath, elPath)
-	if err != nil {
-		log.Fatalf("error loading SPDX license IDs from %s, %s: %v", llPath, elPath, err)
-	}
+func report(jsResults string, jsReportOutput string, licenseList string) {
+	// load the SPDX License List
+	catalog := loadLicenseCatalog(licenseList)
 
 	// load results
 	dr, err := npm.LoadResults(jsResults)
@@ -42,7 +52,7 @@ func report(jsResults string, jsReportOutput string) {
 
 	// analyze
 	lics := map[string]*licEntry{}
-	for p, pData := range dr.Results {
+	for _, pData := range dr.Results {
 		l := pData.License
 		if l == "" {
 			l = "NOASSERTION"
@@ -53,7 +63,15 @@ func report(jsResults string, jsReportOutput string) {
 			le = &licEntry{}
 			le.LicID = l
 
-			le.IsSPDX = spdxlicenses.IsValidExpression(l, allLics)
+			expr, err := spdxlicenses.ValidateExpression(l, catalog)
+			le.IsSPDX = err == nil
+			if expr != nil {
+				le.Licenses = getLicInfos(expr, catalog)
+				// flag IDs that should be replaced, e.g. GPL-2.0
+				if ids := spdxlicenses.GetDeprecatedIDs(expr, catalog); len(ids) > 0 {
+					le.Deprecated = ids
+				}
+			}
 
 			le.Deps = []packageVersion{}
 			lics[l] = le
@@ -61,14 +79,17 @@ func report(jsResults string, jsReportOutput string) {
 
 		// add this version
 		pv := packageVersion{
-			Pkg:            p,
+			Pkg:            pData.Name,
 			Ver:            pData.Version,
 			IsDirectDep:    pData.IsDirectDep,
 			IsDirectDevDep: pData.IsDirectDevDep,
+			Error:          pData.Error,
 		}
 		le.Deps = append(le.Deps, pv)
 	}
 
+	printDeprecatedLicenses(lics)
+
 	// create JSON output
 	js, err := json.Marshal(&lics)
 	if err != nil {
@@ -81,3 +102,41 @@ func report(jsResults string, jsReportOutput string) {
 		log.Fatalf("error writing JSON to %s: %v", jsReportOutput, err)
 	}
 }
+
+// getLicInfos returns the details of each license from the SPDX
+// License List that is used in expr.
+func getLicInfos(expr spdxlicenses.Expression, catalog *spdxlicenses.Catalog) []licInfo {
+	infos := []licInfo{}
+	for _, id := range spdxlicenses.GetLicenseIDs(expr) {
+		l := catalog.Licenses[id]
+		infos = append(infos, licInfo{
+			LicID:         l.ID,
+			Name:          l.Name,
+			IsOSIApproved: l.IsOSIApproved,
+			IsFSFLibre:    l.IsFSFLibre,
+		})
+	}
+	return infos
+}
+
+// printDeprecatedLicenses lists the license expressions that use
+// deprecated SPDX license IDs, and how many package versions use
+// each one.
+func printDeprecatedLicenses(lics map[string]*licEntry) {
+	ls := []string{}
+	for l, le := range lics {
+		if len(le.Deprecated) > 0 {
+			ls = append(ls, l)
+		}
+	}
+	if len(ls) == 0 {
+		return
+	}
+	sort.Strings(ls)
+
+	fmt.Printf("Warning: these licenses use deprecated SPDX license IDs:\n")
+	for _, l := range ls {
+		le := lics[l]
+		fmt.Printf("\t%s (deprecated: %s): %d package versions\n", l, strings.Join(le.Deprecated, ", "), len(le.Deps))
+	}
+}
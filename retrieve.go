@@ -4,13 +4,131 @@
 package main
 
 import (
+	"context"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"time"
 
 	"github.com/swinslow/npm-spdx/pkg/npm"
 )
 
-func retrieve(pjsFilename, pljsFilename, jsOutput string) {
+// retrieveOptions contains the optional settings for the
+// retrieve and export-snapshot commands.
+type retrieveOptions struct {
+	registry    string
+	concurrency int
+	rate        float64
+	cacheDir    string
+	noCache     bool
+	cacheMaxAge time.Duration
+	offline     bool
+	snapshot    string
+	checkpoint  string
+	resume      bool
+	failSoft    bool
+	timeout     time.Duration
+	licenseList string
+}
+
+func retrieve(pjsFilename, lockFilename, jsOutput string, opts *retrieveOptions) {
+	manifest, workspaces, lockDeps := loadLockDependencies(pjsFilename, lockFilename)
+	catalog := loadLicenseCatalog(opts.licenseList)
+
+	var allResults map[string]*npm.Dependency
+	var cp *npm.Checkpoint
+	if opts.offline || opts.snapshot != "" {
+		// use a previously-exported snapshot, or else whatever is
+		// in the cache
+		snapshotPath := opts.snapshot
+		if snapshotPath == "" {
+			snapshotPath = getCacheDir(opts)
+		}
+		snap, err := npm.LoadSnapshot(snapshotPath)
+		if err != nil {
+			log.Fatalf("error loading snapshot from %s: %v", snapshotPath, err)
+		}
+		allResults, err = npm.GetOfflineDependencies(snap, lockDeps, manifest)
+		if err != nil {
+			log.Fatalf("error getting version data from %s: %v", snapshotPath, err)
+		}
+	} else {
+		cfg := loadRegistryConfig(pjsFilename, opts)
+		client := newClient(cfg, opts)
+		ropts := getRetrieveOptions(opts)
+		ropts.FailSoft = opts.failSoft
+
+		// save progress as we go, so that a failed retrieval can be
+		// resumed
+		cpPath := opts.checkpoint
+		if cpPath == "" {
+			cpPath = jsOutput + ".checkpoint"
+		}
+		var err error
+		if opts.resume {
+			cp, err = npm.LoadCheckpoint(cpPath, manifest)
+			if err != nil {
+				log.Fatalf("error resuming from checkpoint: %v", err)
+			}
+		} else {
+			cp = npm.NewCheckpoint(cpPath, manifest)
+		}
+		ropts.Checkpoint = cp
+
+		ctx, stop := newInterruptContext()
+		allResults, err = npm.GetAllDependencies(ctx, client, lockDeps, manifest, ropts)
+		stop()
+		if err != nil {
+			log.Fatalf("error getting version data: %v\nprogress was saved to %s; run again with --resume to continue", err, cpPath)
+		}
+		fmt.Printf("Retrieved %d package versions: %v\n", len(allResults), cfg.Stats)
+	}
+
+	normalizeLicenses(allResults, catalog)
+
+	dr := &npm.DependencyResults{
+		Name:                manifest.Name,
+		Version:             manifest.Version,
+		License:             manifest.License,
+		BundledDependencies: npm.GetRootBundledDependencies(lockDeps, manifest),
+		Workspaces:          npm.BuildWorkspaces(workspaces, lockDeps),
+		Results:             allResults,
+	}
+
+	err := npm.SaveResults(dr, jsOutput)
+	if err != nil {
+		log.Fatalf("error saving to %s: %v", jsOutput, err)
+	}
+
+	// list any packages that couldn't be retrieved; the checkpoint
+	// is kept so that just those can be retried with --resume
+	failed := npm.GetFailedDependencies(allResults)
+	if len(failed) > 0 {
+		writeFailureSummary(os.Stdout, failed)
+		err = cp.Save()
+		if err != nil {
+			fmt.Printf("Warning: %v\n", err)
+		} else if cp != nil {
+			fmt.Printf("Run again with --resume to retry just these.\n")
+		}
+		return
+	}
+
+	// the checkpoint isn't needed now that we have the full results
+	err = cp.Remove()
+	if err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	}
+}
+
+// loadLockDependencies reads and parses the package.json file, its
+// workspaces' package.json files, and the lockfile.
+func loadLockDependencies(pjsFilename, lockFilename string) (*npm.PackageManifest, map[string]*npm.PackageManifest, map[string]*npm.PackageLockDependency) {
 	js, err := ioutil.ReadFile(pjsFilename)
 	if err != nil {
 		log.Fatalf("error reading %s: %v", pjsFilename, err)
@@ -21,30 +139,105 @@ func retrieve(pjsFilename, pljsFilename, jsOutput string) {
 		log.Fatalf("error parsing %s: %v", pjsFilename, err)
 	}
 
-	ljs, err := ioutil.ReadFile(pljsFilename)
+	lockBytes, err := ioutil.ReadFile(lockFilename)
 	if err != nil {
-		log.Fatalf("error reading %s: %v", pljsFilename, err)
+		log.Fatalf("error reading %s: %v", lockFilename, err)
 	}
 
-	lockManifest, err := npm.ParseLockManifest(ljs)
+	workspaces, err := npm.LoadWorkspaceManifests(filepath.Dir(pjsFilename), manifest)
 	if err != nil {
-		log.Fatalf("error parsing %s: %v", pljsFilename, err)
+		log.Fatalf("error loading workspaces for %s: %v", pjsFilename, err)
 	}
 
-	allResults, err := npm.GetAllDependencies(lockManifest.Dependencies, manifest, 500)
+	lockDeps, err := npm.ParseLockDependencies(lockBytes, manifest, workspaces)
 	if err != nil {
-		log.Fatalf("error getting version data: %v", err)
+		log.Fatalf("error parsing %s: %v", lockFilename, err)
 	}
 
-	dr := &npm.DependencyResults{
-		Name:    manifest.Name,
-		Version: manifest.Version,
-		License: manifest.License,
-		Results: allResults,
+	return manifest, workspaces, lockDeps
+}
+
+// loadRegistryConfig loads the registry settings from the user's
+// and project's .npmrc files, applies any overrides from the
+// command line, and sets up the on-disk cache of registry data.
+func loadRegistryConfig(pjsFilename string, opts *retrieveOptions) *npm.RegistryConfig {
+	cfg, err := npm.LoadRegistryConfig(filepath.Dir(pjsFilename))
+	if err != nil {
+		log.Fatalf("error loading .npmrc settings: %v", err)
+	}
+	if opts.registry != "" {
+		cfg.SetRegistry(opts.registry)
+	}
+
+	if !opts.noCache {
+		cfg.Cache, err = npm.NewCache(getCacheDir(opts), opts.cacheMaxAge)
+		if err != nil {
+			log.Fatalf("error setting up cache: %v", err)
+		}
 	}
 
-	err = npm.SaveResults(dr, jsOutput)
+	return cfg
+}
+
+// newClient returns the registry client to use with the
+// RegistryConfig.
+func newClient(cfg *npm.RegistryConfig, opts *retrieveOptions) *npm.Client {
+	client := npm.NewClient(cfg)
+	client.HTTPClient = &http.Client{Timeout: opts.timeout}
+	return client
+}
+
+// newInterruptContext returns a context that is cancelled when the
+// program is interrupted (e.g. by Ctrl-C), so that progress can be
+// saved before exiting, and a function to call once it is no
+// longer needed. A second interrupt exits immediately.
+func newInterruptContext() (context.Context, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt)
+	go func() {
+		select {
+		case <-sigs:
+			fmt.Printf("Interrupted, stopping...\n")
+			cancel()
+			signal.Stop(sigs)
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, func() {
+		signal.Stop(sigs)
+		cancel()
+	}
+}
+
+// getCacheDir returns the directory for the on-disk cache of
+// registry data.
+func getCacheDir(opts *retrieveOptions) string {
+	if opts.cacheDir != "" {
+		return opts.cacheDir
+	}
+	cacheDir, err := npm.DefaultCacheDir()
 	if err != nil {
-		log.Fatalf("error saving to %s: %v", jsOutput, err)
+		log.Fatalf("error setting up cache: %v", err)
+	}
+	return cacheDir
+}
+
+// getRetrieveOptions returns the npm.RetrieveOptions for the
+// command line settings.
+func getRetrieveOptions(opts *retrieveOptions) *npm.RetrieveOptions {
+	return &npm.RetrieveOptions{
+		Concurrency:       opts.concurrency,
+		RequestsPerSecond: opts.rate,
+		Burst:             opts.concurrency,
+	}
+}
+
+// writeFailureSummary writes the list of package versions that
+// could not be retrieved, with the reason for each, to w.
+func writeFailureSummary(w io.Writer, failed []*npm.Dependency) {
+	fmt.Fprintf(w, "\n%d package versions could not be retrieved:\n", len(failed))
+	for _, d := range failed {
+		fmt.Fprintf(w, "\t%s: %s\n", npm.DependencyKey(d.Name, d.Version), d.Error)
 	}
 }
@@ -0,0 +1,47 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright The Linux Foundation and npm-spdx contributors.
+
+package main
+
+import (
+	"io/ioutil"
+	"log"
+	"path/filepath"
+
+	"github.com/swinslow/npm-spdx/pkg/npm"
+)
+
+func scan(pjsFilename, jsOutput string, licenseList string) {
+	catalog := loadLicenseCatalog(licenseList)
+
+	js, err := ioutil.ReadFile(pjsFilename)
+	if err != nil {
+		log.Fatalf("error reading %s: %v", pjsFilename, err)
+	}
+
+	manifest, err := npm.ParseManifest(js)
+	if err != nil {
+		log.Fatalf("error parsing %s: %v", pjsFilename, err)
+	}
+
+	rootDir := filepath.Dir(pjsFilename)
+	allResults, err := npm.ScanNodeModules(rootDir, manifest)
+	if err != nil {
+		log.Fatalf("error scanning node_modules in %s: %v", rootDir, err)
+	}
+
+	normalizeLicenses(allResults, catalog)
+
+	dr := &npm.DependencyResults{
+		Name:                manifest.Name,
+		Version:             manifest.Version,
+		License:             manifest.License,
+		BundledDependencies: manifest.GetBundledDependencies(),
+		Results:             allResults,
+	}
+
+	err = npm.SaveResults(dr, jsOutput)
+	if err != nil {
+		log.Fatalf("error saving to %s: %v", jsOutput, err)
+	}
+}
@@ -0,0 +1,25 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright The Linux Foundation and npm-spdx contributors.
+
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/swinslow/npm-spdx/pkg/npm"
+)
+
+func exportSnapshot(pjsFilename, lockFilename, snapshotOutput string, opts *retrieveOptions) {
+	_, _, lockDeps := loadLockDependencies(pjsFilename, lockFilename)
+	cfg := loadRegistryConfig(pjsFilename, opts)
+	client := newClient(cfg, opts)
+
+	ctx, stop := newInterruptContext()
+	defer stop()
+	err := npm.ExportSnapshot(ctx, client, lockDeps, getRetrieveOptions(opts), snapshotOutput)
+	if err != nil {
+		log.Fatalf("error exporting snapshot to %s: %v", snapshotOutput, err)
+	}
+	fmt.Printf("Exported snapshot to %s: %v\n", snapshotOutput, cfg.Stats)
+}
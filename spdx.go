@@ -12,7 +12,9 @@ import (
 	"github.com/swinslow/npm-spdx/pkg/spdxpackages"
 )
 
-func spdx(jsResults, spdxOutput string) {
+func spdx(jsResults, spdxOutput string, licenseList string, opts *spdxpackages.BuildOptions) {
+	catalog := loadLicenseCatalog(licenseList)
+
 	// load results from JSON file
 	dr, err := npm.LoadResults(jsResults)
 	if err != nil {
@@ -20,7 +22,7 @@ func spdx(jsResults, spdxOutput string) {
 	}
 
 	// create SPDX document from results
-	doc, err := spdxpackages.BuildSPDXDocument(dr)
+	doc, err := spdxpackages.BuildSPDXDocument(dr, catalog, opts)
 	if err != nil {
 		log.Fatalf("error building SPDX document from %s: %v", jsResults, err)
 	}
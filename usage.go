@@ -14,12 +14,122 @@ Usage: %s <COMMAND> [arguments]
 
 Commands:
 	retrieve    - retrieve dependency info from NPM API and save to disk
+	export-snapshot
+	            - save the NPM API data needed for a lockfile, for offline use
+	scan        - read dependency info from an installed node_modules tree and save to disk
 	report      - load previously-retrieved dependency info and print summary details
 	spdx        - load previously-retrieved dependency info and save as SPDX tag-value file
 
 `, os.Args[0])
 }
 
+func printRetrieveUsage() {
+	log.Fatalf(`
+Usage: %s retrieve [OPTIONS] <PACKAGE.JSON> <LOCKFILE> <RESULTS.JSON>
+
+PACKAGE.JSON:       path to package.json file for analysis
+LOCKFILE:           path to package-lock.json, npm-shrinkwrap.json, yarn.lock or
+                    pnpm-lock.yaml file for analysis
+RESULTS.JSON:       output path for results of API queries
+
+Options:
+	--registry URL     registry to query for unscoped packages, overriding any
+	                   "registry" setting in .npmrc files; scopes with their
+	                   own "@scope:registry" setting still use that registry
+	--concurrency N    maximum number of registry requests in progress at once
+	                   (default 8)
+	--rate R           maximum average number of registry requests started per
+	                   second, or 0 for no limit (default 20)
+	--cache-dir DIR    directory for cached registry data (default: npm-spdx in
+	                   the user's cache directory)
+	--cache-max-age D  how long cached data is used before it is revalidated
+	                   with the registry, e.g. 1h or 0s (default 24h)
+	--no-cache         don't read or write cached registry data
+	--timeout D        time limit for each registry request, e.g. 30s, or 0 for
+	                   no limit (default 1m)
+	--offline          don't query the registry; use the data in the --snapshot,
+	                   or else in the cache directory
+	--snapshot PATH    snapshot directory or archive (from 'export-snapshot') to
+	                   use instead of the registry; implies --offline
+	--checkpoint FILE  file where partial results are saved during retrieval
+	                   (default: RESULTS.JSON with ".checkpoint" appended)
+	--resume           continue from the checkpoint of an earlier retrieval
+	                   that failed, rather than starting again
+	--fail-soft        record packages whose data can't be retrieved as failed,
+	                   with the reason, and carry on with the rest
+	--license-list FILE
+	                   licenses.json file from a release of the SPDX License
+	                   List data (with exceptions.json in the same directory)
+	                   to use instead of the built-in version 3.5
+`, os.Args[0])
+}
+
+func printExportSnapshotUsage() {
+	log.Fatalf(`
+Usage: %s export-snapshot [OPTIONS] <PACKAGE.JSON> <LOCKFILE> <SNAPSHOT.TAR.GZ>
+
+PACKAGE.JSON:       path to package.json file for analysis
+LOCKFILE:           path to package-lock.json, npm-shrinkwrap.json, yarn.lock or
+                    pnpm-lock.yaml file for analysis
+SNAPSHOT.TAR.GZ:    output path for archive of registry data, for use with
+                    'retrieve --snapshot'
+
+Options:
+	--registry, --concurrency, --rate, --cache-dir, --cache-max-age,
+	--no-cache and --timeout are the same as for 'retrieve'
+`, os.Args[0])
+}
+
+func printScanUsage() {
+	log.Fatalf(`
+Usage: %s scan [OPTIONS] <PACKAGE.JSON> <RESULTS.JSON>
+
+PACKAGE.JSON:       path to package.json file for analysis; the node_modules
+                    directory next to it will be scanned
+RESULTS.JSON:       output path for results
+
+Options:
+	--license-list FILE
+	                   licenses.json file from a release of the SPDX License
+	                   List data (with exceptions.json in the same directory)
+	                   to use instead of the built-in version 3.5
+`, os.Args[0])
+}
+
+func printReportUsage() {
+	log.Fatalf(`
+Usage: %s report [OPTIONS] <RESULTS.JSON> <SUMMARY.JSON>
+
+RESULTS.JSON:       path to results from API queries (from prior 'retrieve' step)
+SUMMARY.JSON:       output path for categorized JSON license results
+
+Options:
+	--license-list FILE
+	                   licenses.json file from a release of the SPDX License
+	                   List data (with exceptions.json in the same directory)
+	                   to use instead of the built-in version 3.5
+`, os.Args[0])
+}
+
+func printSpdxUsage() {
+	log.Fatalf(`
+Usage: %s spdx [OPTIONS] <RESULTS.JSON> <OUTPUT.SPDX>
+
+RESULTS.JSON:       path to results from API queries (from prior 'retrieve' step)
+OUTPUT.SPDX:        output path for SPDX tag-value file
+
+Options:
+	--upgrade-deprecated
+	                   replace deprecated SPDX license IDs with their current
+	                   equivalents, e.g. GPL-2.0 with GPL-2.0-only, and GPL-2.0+
+	                   with GPL-2.0-or-later
+	--license-list FILE
+	                   licenses.json file from a release of the SPDX License
+	                   List data (with exceptions.json in the same directory)
+	                   to use instead of the built-in version 3.5
+`, os.Args[0])
+}
+
 func checkUsage() {
 	if len(os.Args) < 2 {
 		printMainUsage()
@@ -29,34 +139,28 @@ func checkUsage() {
 	switch command {
 
 	case "retrieve":
-		if len(os.Args) != 5 {
-			log.Fatalf(`
-Usage: %s retrieve <PACKAGE.JSON> <PACKAGE-LOCK.JSON> <RESULTS.JSON>
+		if len(os.Args) < 5 {
+			printRetrieveUsage()
+		}
 
-PACKAGE.JSON:       path to package.json file for analysis
-PACKAGE-LOCK.JSON:  path to package-lock.json file for analysis
-RESULTS.JSON:       output path for results of API queries
-`, os.Args[0])
+	case "export-snapshot":
+		if len(os.Args) < 5 {
+			printExportSnapshotUsage()
 		}
 
-	case "report":
-		if len(os.Args) != 4 {
-			log.Fatalf(`
-Usage: %s report <RESULTS.JSON> <SUMMARY.JSON>
+	case "scan":
+		if len(os.Args) < 4 {
+			printScanUsage()
+		}
 
-RESULTS.JSON:       path to results from API queries (from prior 'retrieve' step)
-SUMMARY.JSON:       output path for categorized JSON license results
-`, os.Args[0])
+	case "report":
+		if len(os.Args) < 4 {
+			printReportUsage()
 		}
 
 	case "spdx":
-		if len(os.Args) != 4 {
-			log.Fatalf(`
-Usage: %s spdx <RESULTS.JSON> <OUTPUT.SPDX>
-
-RESULTS.JSON:       path to results from API queries (from prior 'retrieve' step)
-OUTPUT.SPDX:        output path for SPDX tag-value file
-`, os.Args[0])
+		if len(os.Args) < 4 {
+			printSpdxUsage()
 		}
 
 	default: